@@ -3,9 +3,17 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/jyoonje/collabview_plugin/server/command"
+	"github.com/jyoonje/collabview_plugin/server/config"
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
 )
 
 // ServeHTTP demonstrates a plugin that handles HTTP requests by greeting the world.
@@ -13,14 +21,38 @@ import (
 func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
 	router := mux.NewRouter()
 
-	// Middleware to require that the user is logged in
-	router.Use(p.MattermostAuthorizationRequired)
+	// Reached without a Mattermost session; the signed token or the one-time link nonce is the credential
+	router.HandleFunc("/api/v1/viewer/verify", p.VerifyViewerTokenHandler).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/v1/viewer/open", p.OpenViewerHandler).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/viewer/artifact", p.ViewerArtifactHandler).Methods(http.MethodGet)
 
 	apiRouter := router.PathPrefix("/api/v1").Subrouter()
 
+	// Middleware to require that the user is logged in
+	apiRouter.Use(p.MattermostAuthorizationRequired)
+
 	apiRouter.HandleFunc("/hello", p.HelloWorld).Methods(http.MethodGet)
 
-	apiRouter.HandleFunc("/fileinfo", p.GetFileInfoHandler).Methods(http.MethodGet)
+	// Routes exposing a file or anything derived from it require read access to its channel
+	fileRouter := apiRouter.NewRoute().Subrouter()
+	fileRouter.Use(p.FileReadPermissionRequired)
+	fileRouter.HandleFunc("/fileinfo", p.GetFileInfoHandler).Methods(http.MethodGet)
+	fileRouter.HandleFunc("/conversions/{fileID}", p.GetConversionStatusHandler).Methods(http.MethodGet)
+	fileRouter.HandleFunc("/viewer/token", p.CreateViewerTokenHandler).Methods(http.MethodPost)
+
+	adminRouter := apiRouter.NewRoute().Subrouter()
+	adminRouter.Use(p.SystemAdminRequired)
+	adminRouter.HandleFunc("/deadletters", p.ListDeadLettersHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/deadletters/{jobID}/redrive", p.RedriveDeadLetterHandler).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/config/validate", p.ValidateConfigHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/cache/stats", p.GetCacheStatsHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/cleanup/audit", p.ListCleanupAuditHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/maintenance/report", p.GetMaintenanceReportHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/reconcile", p.ReconcileHandler).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/backfills", p.ListBackfillsHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/backfills", p.StartBackfillHandler).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/backfills/{backfillID}", p.GetBackfillHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/backfills/{backfillID}/cancel", p.CancelBackfillHandler).Methods(http.MethodPost)
 
 	router.ServeHTTP(w, r)
 }
@@ -37,6 +69,78 @@ func (p *Plugin) MattermostAuthorizationRequired(next http.Handler) http.Handler
 	})
 }
 
+// FileReadPermissionRequired resolves the requested file to the post it is attached to and only
+// lets the request through when the user can read that post's channel. The file ID is taken from
+// the {fileID} route variable or the fileID query parameter.
+func (p *Plugin) FileReadPermissionRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Header.Get("Mattermost-User-ID")
+		fileID := mux.Vars(r)["fileID"]
+		if fileID == "" {
+			fileID = r.URL.Query().Get("fileID")
+		}
+		if fileID == "" {
+			http.Error(w, "Missing fileID", http.StatusBadRequest)
+			return
+		}
+
+		allowed, status := p.canReadFile(userID, fileID)
+		if !allowed {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// canReadFile reports whether the user may read the file, along with the HTTP status to answer
+// with when they may not.
+func (p *Plugin) canReadFile(userID, fileID string) (bool, int) {
+	fileInfo, appErr := p.API.GetFileInfo(fileID)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return false, http.StatusNotFound
+		}
+		p.client.Log.Error("Error getting file info", "fileID", fileID, "error", appErr.Error())
+		return false, http.StatusInternalServerError
+	}
+
+	if fileInfo.PostId == "" {
+		// Uploaded but never posted: only the uploader may see it.
+		if fileInfo.CreatorId != userID {
+			return false, http.StatusForbidden
+		}
+		return true, http.StatusOK
+	}
+
+	post, appErr := p.API.GetPost(fileInfo.PostId)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return false, http.StatusNotFound
+		}
+		p.client.Log.Error("Error getting post", "postID", fileInfo.PostId, "error", appErr.Error())
+		return false, http.StatusInternalServerError
+	}
+
+	if !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PermissionReadChannel) {
+		return false, http.StatusForbidden
+	}
+	return true, http.StatusOK
+}
+
+func (p *Plugin) SystemAdminRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Header.Get("Mattermost-User-ID")
+		if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (p *Plugin) HelloWorld(w http.ResponseWriter, r *http.Request) {
 	if _, err := w.Write([]byte("Hello, world!")); err != nil {
 		p.client.Log.Error("Failed to write response", "error", err)
@@ -46,10 +150,6 @@ func (p *Plugin) HelloWorld(w http.ResponseWriter, r *http.Request) {
 
 func (p *Plugin) GetFileInfoHandler(w http.ResponseWriter, r *http.Request) {
 	fileID := r.URL.Query().Get("fileID")
-	if fileID == "" {
-		http.Error(w, "Missing fileID", http.StatusBadRequest)
-		return
-	}
 
 	fileInfo, appErr := p.API.GetFile(fileID)
 	if appErr != nil {
@@ -64,3 +164,262 @@ func (p *Plugin) GetFileInfoHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
+
+func (p *Plugin) GetConversionStatusHandler(w http.ResponseWriter, r *http.Request) {
+	fileID := mux.Vars(r)["fileID"]
+
+	status, err := p.kvstore.GetConversionStatus(fileID)
+	if err != nil {
+		p.client.Log.Error("Error getting conversion status", "fileID", fileID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if status == nil {
+		http.Error(w, "Conversion not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		p.client.Log.Error("Error encoding conversion status", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (p *Plugin) ListDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := p.kvstore.ListDeadLetters()
+	if err != nil {
+		p.client.Log.Error("Error listing dead letters", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		p.client.Log.Error("Error encoding dead letters", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (p *Plugin) RedriveDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["jobID"]
+
+	job, err := p.redriveJob(jobID)
+	if err != nil {
+		p.client.Log.Error("Error redriving dead letter", "jobID", jobID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		http.Error(w, "Dead letter not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		p.client.Log.Error("Error encoding job", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ValidateConfigHandler re-runs the configuration checks against the active configuration so
+// admins can see what is wrong without digging through the server logs.
+func (p *Plugin) ValidateConfigHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := p.snapshot()
+	if cfg == nil {
+		http.Error(w, "Plugin is not active", http.StatusServiceUnavailable)
+		return
+	}
+
+	problems := config.Validate(cfg.Config)
+	if problems == nil {
+		problems = config.Problems{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(problems); err != nil {
+		p.client.Log.Error("Error encoding configuration problems", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GetCacheStatsHandler reports how many conversions were served from the conversion cache.
+func (p *Plugin) GetCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := p.kvstore.GetCacheStats()
+	if err != nil {
+		p.client.Log.Error("Error getting cache stats", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		p.client.Log.Error("Error encoding cache stats", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ListCleanupAuditHandler lists the completed artifact cleanups, most recent first.
+func (p *Plugin) ListCleanupAuditHandler(w http.ResponseWriter, r *http.Request) {
+	records, err := p.kvstore.ListAuditRecords()
+	if err != nil {
+		p.client.Log.Error("Error listing cleanup audit records", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CompletedAt > records[j].CompletedAt })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		p.client.Log.Error("Error encoding cleanup audit records", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (p *Plugin) GetMaintenanceReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := p.kvstore.GetMaintenanceReport()
+	if err != nil {
+		p.client.Log.Error("Error getting maintenance report", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if report == nil {
+		http.Error(w, "No maintenance sweep has run yet", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		p.client.Log.Error("Error encoding maintenance report", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ReconcileHandler runs a reconciliation pass right away and returns its report.
+func (p *Plugin) ReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := p.snapshot()
+	if cfg == nil {
+		http.Error(w, "Plugin is not active", http.StatusServiceUnavailable)
+		return
+	}
+	if len(cfg.ReconcileChannels()) == 0 {
+		http.Error(w, "No reconciliation channels are configured", http.StatusBadRequest)
+		return
+	}
+
+	report := p.reconcile(r.Context(), cfg, time.Now())
+	p.logReconcileReport(report)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		p.client.Log.Error("Error encoding reconciliation report", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type startBackfillRequest struct {
+	TeamID    string `json:"team_id"`
+	ChannelID string `json:"channel_id"`
+	// Since is the date of the oldest posts to convert, formatted as YYYY-MM-DD.
+	Since string `json:"since"`
+}
+
+// backfillStatus is a backfill with its estimated progress.
+type backfillStatus struct {
+	*kvstore.Backfill
+	Progress   float64 `json:"progress"`
+	ETASeconds int64   `json:"eta_seconds"`
+}
+
+func newBackfillStatus(backfill *kvstore.Backfill) backfillStatus {
+	return backfillStatus{
+		Backfill:   backfill,
+		Progress:   backfill.Progress(),
+		ETASeconds: int64(backfill.ETA(time.Now()).Seconds()),
+	}
+}
+
+func (p *Plugin) StartBackfillHandler(w http.ResponseWriter, r *http.Request) {
+	var request startBackfillRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	since, err := time.Parse(command.BackfillDateLayout, request.Since)
+	if err != nil {
+		http.Error(w, "since must be formatted as YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	backfill, err := p.StartBackfill(command.BackfillRequest{
+		UserID:    r.Header.Get("Mattermost-User-ID"),
+		TeamID:    request.TeamID,
+		ChannelID: request.ChannelID,
+		Since:     since,
+	})
+	if errors.Is(err, errInvalidBackfill) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		p.client.Log.Error("Error starting backfill", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(newBackfillStatus(backfill)); err != nil {
+		p.client.Log.Error("Error encoding backfill", "error", err)
+	}
+}
+
+func (p *Plugin) ListBackfillsHandler(w http.ResponseWriter, r *http.Request) {
+	backfills, err := p.kvstore.ListBackfills()
+	if err != nil {
+		p.client.Log.Error("Error listing backfills", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(backfills, func(i, j int) bool {
+		return backfills[i].CreatedAt > backfills[j].CreatedAt
+	})
+
+	statuses := make([]backfillStatus, 0, len(backfills))
+	for _, backfill := range backfills {
+		statuses = append(statuses, newBackfillStatus(backfill))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		p.client.Log.Error("Error encoding backfills", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (p *Plugin) GetBackfillHandler(w http.ResponseWriter, r *http.Request) {
+	p.writeBackfill(w, mux.Vars(r)["backfillID"], p.GetBackfill)
+}
+
+func (p *Plugin) CancelBackfillHandler(w http.ResponseWriter, r *http.Request) {
+	p.writeBackfill(w, mux.Vars(r)["backfillID"], p.CancelBackfill)
+}
+
+func (p *Plugin) writeBackfill(w http.ResponseWriter, backfillID string, load func(string) (*kvstore.Backfill, error)) {
+	backfill, err := load(backfillID)
+	if err != nil {
+		p.client.Log.Error("Error getting backfill", "backfillID", backfillID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if backfill == nil {
+		http.Error(w, "Backfill not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newBackfillStatus(backfill)); err != nil {
+		p.client.Log.Error("Error encoding backfill", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
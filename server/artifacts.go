@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/jyoonje/collabview_plugin/server/config"
+	"github.com/jyoonje/collabview_plugin/server/store/artifactstore"
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+// fileStoreArtifactPrefix returns where artifacts are kept inside Mattermost's own file storage.
+// The manifest is only decoded in init, so this cannot be a package-level value.
+func fileStoreArtifactPrefix() string {
+	return "plugins/" + manifest.Id + "/artifacts"
+}
+
+// newArtifactStore builds the store converted files are published to.
+func (p *Plugin) newArtifactStore(cfg *config.Config) (artifactstore.ArtifactStore, error) {
+	switch cfg.ArtifactStore {
+	case artifactstore.LocalStoreName:
+		return artifactstore.NewLocalStore(cfg.LocalArtifactRoot()), nil
+	case artifactstore.FileStoreName:
+		serverConfig := p.API.GetUnsanitizedConfig()
+		if serverConfig == nil {
+			return nil, errors.New("failed to read the Mattermost file storage settings")
+		}
+		return artifactstore.NewFileStore(serverConfig.FileSettings, cfg.MattermostDataRoot, fileStoreArtifactPrefix())
+	case artifactstore.S3StoreName:
+		return artifactstore.NewS3Store(artifactstore.S3Options{
+			Endpoint:        cfg.S3Endpoint,
+			Bucket:          cfg.S3Bucket,
+			Region:          cfg.S3Region,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			Prefix:          cfg.S3PathPrefix,
+		})
+	default:
+		return nil, errors.Errorf("unknown artifact store %q", cfg.ArtifactStore)
+	}
+}
+
+// publishArtifact hands the converted file over to the artifact store under key and returns its
+// size. Stores that can adopt a local file move it; the others receive a copy and the local
+// file is removed once it is published.
+func (p *Plugin) publishArtifact(ctx context.Context, cfg *activeConfig, sourceFile, key string) (int64, error) {
+	file, err := os.Open(sourceFile)
+	if err != nil {
+		return 0, errors.Wrapf(err, "변환 파일 열기 실패: %s", sourceFile)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, errors.Wrapf(err, "변환 파일 정보 조회 실패: %s", sourceFile)
+	}
+
+	if mover, ok := cfg.artifacts.(artifactstore.Mover); ok {
+		file.Close()
+		if err := mover.Move(ctx, key, sourceFile); err != nil {
+			return 0, errors.Wrapf(err, ".esob 파일 게시 실패: %s -> %s", sourceFile, key)
+		}
+		p.API.LogInfo(".esob 파일 게시 성공", "from", sourceFile, "key", key, "store", cfg.ArtifactStore)
+		return info.Size(), nil
+	}
+
+	if err := cfg.artifacts.Put(ctx, key, file, info.Size()); err != nil {
+		return 0, errors.Wrapf(err, ".esob 파일 게시 실패: %s -> %s", sourceFile, key)
+	}
+	p.API.LogInfo(".esob 파일 게시 성공", "from", sourceFile, "key", key, "store", cfg.ArtifactStore)
+
+	file.Close()
+	if err := os.Remove(sourceFile); err != nil {
+		p.API.LogError("원본 .esob 파일 삭제 실패", "path", sourceFile, "error", err.Error())
+	}
+	return info.Size(), nil
+}
+
+// recordArtifact saves the manifest entry of a freshly published artifact. An artifact the file
+// had under a different key, e.g. from an older naming scheme, is removed.
+func (p *Plugin) recordArtifact(ctx context.Context, cfg *activeConfig, artifact *kvstore.Artifact) error {
+	previous, err := p.kvstore.GetArtifact(artifact.FileID)
+	if err != nil {
+		return err
+	}
+	if err := p.kvstore.SaveArtifact(artifact); err != nil {
+		return err
+	}
+
+	if previous != nil && previous.Key != artifact.Key {
+		if err := cfg.artifacts.Delete(ctx, previous.Key); err != nil {
+			p.API.LogWarn("이전 .esob 파일 삭제 실패", "fileID", artifact.FileID, "key", previous.Key, "error", err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+func TestPublishArtifact(t *testing.T) {
+	p, api, store := newTestPlugin(t)
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything).Maybe()
+	cfg := p.snapshot()
+
+	source := filepath.Join(t.TempDir(), "plan.esob")
+	require.NoError(t, os.WriteFile(source, []byte("artifact"), 0600))
+
+	size, err := p.publishArtifact(context.Background(), cfg, source, "post/plan.esob")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), size)
+
+	content, err := os.ReadFile(filepath.Join(store.Root(), "post", "plan.esob"))
+	require.NoError(t, err)
+	assert.Equal(t, "artifact", string(content))
+	assert.NoFileExists(t, source, "the local copy is removed once published")
+
+	_, err = p.publishArtifact(context.Background(), cfg, source, "post/plan.esob")
+	assert.Error(t, err, "a missing source fails")
+}
+
+func TestRecordArtifactRemovesPreviousKey(t *testing.T) {
+	p, api, store := newTestPlugin(t)
+	cfg := p.snapshot()
+
+	ctx := context.Background()
+	require.NoError(t, store.Put(ctx, "post/plan.esob", strings.NewReader("old"), 3))
+
+	previous, _ := json.Marshal(&kvstore.Artifact{FileID: "file", PostID: "post", Key: "post/plan.esob"})
+	api.On("KVGet", "artifact-file").Return(previous, nil)
+	api.On("KVSetWithOptions", "artifact-file", mock.Anything, mock.Anything).Return(true, nil)
+
+	artifact := &kvstore.Artifact{FileID: "file", PostID: "post", Key: "post/file/plan.esob", Name: "plan.pdf"}
+	require.NoError(t, p.recordArtifact(ctx, cfg, artifact))
+
+	api.AssertCalled(t, "KVSetWithOptions", "artifact-file", mock.Anything, mock.Anything)
+	assert.NoFileExists(t, filepath.Join(store.Root(), "post", "plan.esob"))
+}
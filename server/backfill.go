@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/pkg/errors"
+
+	"github.com/jyoonje/collabview_plugin/server/command"
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+const (
+	// backfillPageSize is the number of posts read per page, and how often the checkpoint is saved.
+	backfillPageSize = 100
+	// backfillChannelsPerPage is the page size used when listing a team's channels.
+	backfillChannelsPerPage = 200
+	// backfillProgressInterval is how often progress is posted to the requester.
+	backfillProgressInterval = time.Minute
+	// backfillRetryDelay is the pause before a page that failed to load is read again.
+	backfillRetryDelay = time.Minute
+)
+
+// errInvalidBackfill marks backfill requests rejected because of their parameters.
+var errInvalidBackfill = errors.New("invalid backfill request")
+
+// StartBackfill implements command.BackfillService.
+func (p *Plugin) StartBackfill(request command.BackfillRequest) (*kvstore.Backfill, error) {
+	if p.snapshot() == nil {
+		return nil, errors.New("plugin is not active")
+	}
+	if (request.TeamID == "") == (request.ChannelID == "") {
+		return nil, errors.Wrap(errInvalidBackfill, "either a team or a channel is required")
+	}
+	if request.Since.After(time.Now()) {
+		return nil, errors.Wrap(errInvalidBackfill, "the start date is in the future")
+	}
+
+	channelIDs, err := p.backfillChannels(request)
+	if err != nil {
+		return nil, err
+	}
+	if len(channelIDs) == 0 {
+		return nil, errors.Wrap(errInvalidBackfill, "the team has no channels to backfill")
+	}
+
+	now := model.GetMillis()
+	backfill := &kvstore.Backfill{
+		ID:             model.NewId(),
+		TeamID:         request.TeamID,
+		ChannelIDs:     channelIDs,
+		Since:          request.Since.UnixMilli(),
+		RequestedBy:    request.UserID,
+		ReplyChannelID: request.ReplyChannelID,
+		State:          kvstore.BackfillStateRunning,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := p.kvstore.SaveBackfill(backfill); err != nil {
+		return nil, err
+	}
+
+	p.API.LogInfo("과거 첨부 파일 변환 시작", "backfillID", backfill.ID, "teamID", request.TeamID, "channels", len(channelIDs), "since", request.Since.Format(command.BackfillDateLayout))
+	go p.runBackfill(p.backfillCtx, backfill.ID)
+	return backfill, nil
+}
+
+// GetBackfill implements command.BackfillService.
+func (p *Plugin) GetBackfill(backfillID string) (*kvstore.Backfill, error) {
+	return p.kvstore.GetBackfill(backfillID)
+}
+
+// CancelBackfill implements command.BackfillService. The runner stops after its current page.
+func (p *Plugin) CancelBackfill(backfillID string) (*kvstore.Backfill, error) {
+	backfill, err := p.kvstore.GetBackfill(backfillID)
+	if err != nil || backfill == nil || backfill.IsFinished() {
+		return backfill, err
+	}
+
+	backfill.State = kvstore.BackfillStateCanceled
+	backfill.UpdatedAt = model.GetMillis()
+	backfill.FinishedAt = backfill.UpdatedAt
+	if err := p.kvstore.SaveBackfill(backfill); err != nil {
+		return nil, err
+	}
+	p.API.LogInfo("과거 첨부 파일 변환 취소", "backfillID", backfill.ID)
+	return backfill, nil
+}
+
+// backfillChannels returns the channels a request covers. A team backfill covers its public
+// channels and the private ones the requester is a member of.
+func (p *Plugin) backfillChannels(request command.BackfillRequest) ([]string, error) {
+	if request.ChannelID != "" {
+		if _, appErr := p.API.GetChannel(request.ChannelID); appErr != nil {
+			if appErr.StatusCode == http.StatusNotFound {
+				return nil, errors.Wrap(errInvalidBackfill, "channel not found")
+			}
+			return nil, appErr
+		}
+		return []string{request.ChannelID}, nil
+	}
+
+	if _, appErr := p.API.GetTeam(request.TeamID); appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return nil, errors.Wrap(errInvalidBackfill, "team not found")
+		}
+		return nil, appErr
+	}
+
+	var channelIDs []string
+	seen := map[string]bool{}
+	add := func(channel *model.Channel) {
+		if !seen[channel.Id] && channel.TeamId == request.TeamID &&
+			(channel.Type == model.ChannelTypeOpen || channel.Type == model.ChannelTypePrivate) {
+			seen[channel.Id] = true
+			channelIDs = append(channelIDs, channel.Id)
+		}
+	}
+
+	for page := 0; ; page++ {
+		channels, appErr := p.API.GetPublicChannelsForTeam(request.TeamID, page, backfillChannelsPerPage)
+		if appErr != nil {
+			return nil, appErr
+		}
+		for _, channel := range channels {
+			add(channel)
+		}
+		if len(channels) < backfillChannelsPerPage {
+			break
+		}
+	}
+
+	member, appErr := p.API.GetChannelsForTeamForUser(request.TeamID, request.UserID, false)
+	if appErr != nil {
+		return nil, appErr
+	}
+	for _, channel := range member {
+		add(channel)
+	}
+	return channelIDs, nil
+}
+
+// resumeBackfills restarts the backfills that were running when the plugin last stopped.
+func (p *Plugin) resumeBackfills() error {
+	backfills, err := p.kvstore.ListBackfills()
+	if err != nil {
+		return err
+	}
+
+	resumed := 0
+	for _, backfill := range backfills {
+		if backfill.IsFinished() {
+			continue
+		}
+		go p.runBackfill(p.backfillCtx, backfill.ID)
+		resumed++
+	}
+	if resumed > 0 {
+		p.API.LogInfo("미완료 과거 첨부 파일 변환 재개", "count", resumed)
+	}
+	return nil
+}
+
+// runBackfill walks the backfill's channels page by page from its checkpoint. Every node of a
+// cluster resumes running backfills, but only the one holding the backfill's lock walks it; if
+// that node goes away, the lock expires and a waiting node carries on from the checkpoint.
+func (p *Plugin) runBackfill(ctx context.Context, backfillID string) {
+	mutex, err := cluster.NewMutex(p.API, "backfill-"+backfillID)
+	if err != nil {
+		p.API.LogError("과거 첨부 파일 변환 잠금 생성 실패", "backfillID", backfillID, "error", err.Error())
+		return
+	}
+	if err := mutex.LockWithContext(ctx); err != nil {
+		return
+	}
+	defer mutex.Unlock()
+
+	backfill, err := p.kvstore.GetBackfill(backfillID)
+	if err != nil {
+		p.API.LogError("과거 첨부 파일 변환 조회 실패", "backfillID", backfillID, "error", err.Error())
+		return
+	}
+
+	reportedAt := time.Now()
+	for backfill != nil && !backfill.IsFinished() {
+		cfg := p.snapshot()
+		if cfg == nil {
+			// The plugin stopped; the backfill is resumed on the next activation.
+			return
+		}
+
+		pageErr := p.backfillPage(ctx, cfg, backfill)
+		if ctx.Err() != nil {
+			p.saveBackfillCheckpoint(backfill)
+			return
+		}
+		if pageErr != nil {
+			backfill.Errors++
+			backfill.LastError = pageErr.Error()
+			p.API.LogError("과거 첨부 파일 조회 실패", "backfillID", backfill.ID, "channelID", backfill.ChannelIDs[backfill.ChannelIndex], "error", pageErr.Error())
+		}
+		if backfill.ChannelIndex >= len(backfill.ChannelIDs) {
+			backfill.State = kvstore.BackfillStateCompleted
+			backfill.FinishedAt = model.GetMillis()
+		}
+		if !p.saveBackfillCheckpoint(backfill) {
+			return
+		}
+
+		if backfill.IsFinished() || time.Since(reportedAt) >= backfillProgressInterval {
+			p.reportBackfillProgress(backfill)
+			reportedAt = time.Now()
+		}
+		if pageErr != nil && sleepContext(ctx, backfillRetryDelay) != nil {
+			return
+		}
+	}
+
+	if backfill != nil && backfill.State == kvstore.BackfillStateCompleted {
+		p.API.LogInfo("과거 첨부 파일 변환 완료", "backfillID", backfill.ID, "posts", backfill.Posts, "files", backfill.Files, "enqueued", backfill.Enqueued)
+	}
+}
+
+// saveBackfillCheckpoint saves the progress of a running backfill, unless it was canceled
+// meanwhile, and reports whether the backfill should carry on.
+func (p *Plugin) saveBackfillCheckpoint(backfill *kvstore.Backfill) bool {
+	backfill.UpdatedAt = model.GetMillis()
+	saved, err := p.kvstore.SaveBackfillCheckpoint(backfill)
+	if err != nil {
+		p.API.LogError("과거 첨부 파일 변환 진행 상황 저장 실패", "backfillID", backfill.ID, "error", err.Error())
+		return true
+	}
+	return saved
+}
+
+// backfillPage processes the next page of posts of the current channel, newest first, and
+// moves the cursor past every post it completed. Reaching a post older than the start date
+// or the first post of the channel moves on to the next channel.
+func (p *Plugin) backfillPage(ctx context.Context, cfg *activeConfig, backfill *kvstore.Backfill) error {
+	channelID := backfill.ChannelIDs[backfill.ChannelIndex]
+
+	var posts *model.PostList
+	var appErr *model.AppError
+	if backfill.CursorPostID == "" {
+		posts, appErr = p.API.GetPostsForChannel(channelID, 0, backfillPageSize)
+	} else {
+		posts, appErr = p.API.GetPostsBefore(channelID, backfill.CursorPostID, 0, backfillPageSize)
+	}
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			p.API.LogWarn("과거 첨부 파일 변환 대상 채널 없음", "backfillID", backfill.ID, "channelID", channelID)
+			nextBackfillChannel(backfill)
+			return nil
+		}
+		return appErr
+	}
+
+	for _, postID := range posts.Order {
+		post := posts.Posts[postID]
+		if post == nil {
+			continue
+		}
+		if post.CreateAt < backfill.Since {
+			nextBackfillChannel(backfill)
+			return nil
+		}
+		if backfill.ChannelStartAt == 0 {
+			backfill.ChannelStartAt = post.CreateAt
+		}
+
+		if post.DeleteAt == 0 && len(post.FileIds) > 0 {
+			backfill.Posts++
+			for _, fileID := range post.FileIds {
+				backfill.Files++
+				problem, err := p.requeueFile(ctx, cfg, post, fileID)
+				if err != nil {
+					backfill.Errors++
+					backfill.LastError = err.Error()
+					p.API.LogError("과거 첨부 파일 변환 등록 실패", "backfillID", backfill.ID, "fileID", fileID, "error", err.Error())
+					continue
+				}
+				if problem == "" {
+					continue
+				}
+				backfill.Enqueued++
+				// Leave room in the queue for the files being posted right now.
+				if err := sleepContext(ctx, cfg.BackfillInterval()); err != nil {
+					return err
+				}
+			}
+		}
+		backfill.CursorPostID = post.Id
+		backfill.CursorAt = post.CreateAt
+	}
+
+	if len(posts.Order) < backfillPageSize {
+		nextBackfillChannel(backfill)
+	}
+	return nil
+}
+
+func nextBackfillChannel(backfill *kvstore.Backfill) {
+	backfill.ChannelIndex++
+	backfill.ChannelStartAt = 0
+	backfill.CursorPostID = ""
+	backfill.CursorAt = 0
+}
+
+// reportBackfillProgress posts the progress of a backfill started from a slash command to its
+// requester.
+func (p *Plugin) reportBackfillProgress(backfill *kvstore.Backfill) {
+	if backfill.ReplyChannelID == "" {
+		return
+	}
+	p.API.SendEphemeralPost(backfill.RequestedBy, &model.Post{
+		ChannelId: backfill.ReplyChannelID,
+		Message:   command.BackfillSummary(backfill, time.Now()),
+	})
+}
+
+// sleepContext waits for the given duration unless the context is canceled first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
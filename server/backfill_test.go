@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+func TestBackfillPage(t *testing.T) {
+	setup := func() (*Plugin, *plugintest.API, *activeConfig) {
+		p, api, _ := newTestPlugin(t)
+		cfg := p.snapshot()
+		cfg.BackfillFilesPerMinute = 60
+		return p, api, cfg
+	}
+
+	t.Run("stops at the start date", func(t *testing.T) {
+		p, api, cfg := setup()
+		posts := model.NewPostList()
+		posts.AddPost(&model.Post{Id: "p3", CreateAt: 3000, FileIds: []string{"f1"}})
+		posts.AddPost(&model.Post{Id: "p2", CreateAt: 2000})
+		posts.AddPost(&model.Post{Id: "p1", CreateAt: 500, FileIds: []string{"f0"}})
+		posts.AddOrder("p3")
+		posts.AddOrder("p2")
+		posts.AddOrder("p1")
+		api.On("GetPostsForChannel", "channel", 0, backfillPageSize).Return(posts, nil)
+
+		// The dead-lettered file is left to the admins and not queued again.
+		status, _ := json.Marshal(&kvstore.ConversionStatus{FileID: "f1", State: kvstore.ConversionStateFailed})
+		api.On("KVGet", "conversion-f1").Return(status, nil)
+
+		backfill := &kvstore.Backfill{ID: "backfill", ChannelIDs: []string{"channel", "other"}, Since: 1000}
+		require.NoError(t, p.backfillPage(context.Background(), cfg, backfill))
+
+		assert.Equal(t, 1, backfill.Posts)
+		assert.Equal(t, 1, backfill.Files)
+		assert.Zero(t, backfill.Enqueued)
+		assert.Equal(t, 1, backfill.ChannelIndex, "moves on to the next channel")
+		assert.Empty(t, backfill.CursorPostID)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("continues from the checkpoint", func(t *testing.T) {
+		p, api, cfg := setup()
+		posts := model.NewPostList()
+		for i := backfillPageSize; i > 0; i-- {
+			id := fmt.Sprintf("post%03d", i)
+			posts.AddPost(&model.Post{Id: id, CreateAt: int64(10000 + i)})
+			posts.AddOrder(id)
+		}
+		api.On("GetPostsBefore", "channel", "cursor", 0, backfillPageSize).Return(posts, nil)
+
+		backfill := &kvstore.Backfill{ID: "backfill", ChannelIDs: []string{"channel"}, Since: 1000, ChannelStartAt: 20000, CursorPostID: "cursor", CursorAt: 15000}
+		require.NoError(t, p.backfillPage(context.Background(), cfg, backfill))
+
+		assert.Zero(t, backfill.ChannelIndex, "a full page may not be the last one")
+		assert.Equal(t, "post001", backfill.CursorPostID)
+		assert.EqualValues(t, 10001, backfill.CursorAt)
+		assert.InDelta(t, float64(20000-10001)/float64(20000-1000), backfill.Progress(), 0.0001)
+		api.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/jyoonje/collabview_plugin/server/store/artifactstore"
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+// hashFile returns the hex-encoded SHA-256 of the file's content.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// reuseCachedArtifact publishes the artifact of identical content converted earlier by the same
+// converter version under the artifact's key, linking or copying it inside the store. It returns
+// the cache entry on a hit and nil when the file must be converted. Every lookup is counted.
+func (p *Plugin) reuseCachedArtifact(ctx context.Context, cfg *activeConfig, artifact *kvstore.Artifact) *kvstore.CacheEntry {
+	entry, err := p.kvstore.GetCacheEntry(artifact.ContentHash, artifact.Converter, artifact.ConverterVersion)
+	if err != nil {
+		p.API.LogWarn("변환 캐시 조회 실패", "fileID", artifact.FileID, "error", err.Error())
+		return nil
+	}
+	hit := entry != nil
+	if hit && entry.ArtifactKey != artifact.Key {
+		err = artifactstore.Copy(ctx, cfg.artifacts, entry.ArtifactKey, artifact.Key)
+	} else if hit {
+		// The same file is converted again; its own artifact is the cached one.
+		_, err = cfg.artifacts.Stat(ctx, artifact.Key)
+	}
+	if err != nil {
+		hit = false
+		if errors.Is(err, artifactstore.ErrNotFound) {
+			// The cached artifact was removed since; forget it.
+			if err := p.kvstore.DeleteCacheEntry(entry.ContentHash, entry.Converter, entry.ConverterVersion); err != nil {
+				p.API.LogWarn("변환 캐시 항목 삭제 실패", "contentHash", entry.ContentHash, "error", err.Error())
+			}
+		} else {
+			p.API.LogWarn("캐시된 .esob 파일 재사용 실패", "fileID", artifact.FileID, "key", entry.ArtifactKey, "error", err.Error())
+		}
+	}
+
+	if err := p.kvstore.RecordCacheLookup(hit); err != nil {
+		p.API.LogWarn("변환 캐시 통계 저장 실패", "error", err.Error())
+	}
+	if !hit {
+		return nil
+	}
+	p.API.LogInfo("변환 캐시 적중", "fileID", artifact.FileID, "from", entry.ArtifactKey, "to", artifact.Key, "converter", artifact.Converter)
+	return entry
+}
+
+// cacheArtifact makes a freshly converted artifact available to later uploads of the same content.
+func (p *Plugin) cacheArtifact(artifact *kvstore.Artifact) {
+	if artifact.ContentHash == "" || artifact.ConverterVersion == "" {
+		return
+	}
+	entry := &kvstore.CacheEntry{
+		ContentHash:      artifact.ContentHash,
+		Converter:        artifact.Converter,
+		ConverterVersion: artifact.ConverterVersion,
+		ArtifactKey:      artifact.Key,
+		FileID:           artifact.FileID,
+		Size:             artifact.Size,
+		CreatedAt:        artifact.PublishedAt,
+	}
+	if err := p.kvstore.SaveCacheEntry(entry); err != nil {
+		p.API.LogWarn("변환 캐시 저장 실패", "fileID", artifact.FileID, "error", err.Error())
+	}
+}
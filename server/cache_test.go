@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.pdf")
+	require.NoError(t, os.WriteFile(path, []byte("drawing"), 0600))
+
+	hash, err := hashFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "27f3282691613a41f159fe0fb8f3791f3b99fa00fc62df29edeeafe496eb0fdd", hash)
+}
+
+func TestReuseCachedArtifact(t *testing.T) {
+	cached, _ := json.Marshal(&kvstore.CacheEntry{
+		ContentHash:      "hash",
+		Converter:        "python",
+		ConverterVersion: "v1",
+		ArtifactKey:      "post-a/file-a/plan.esob",
+		Size:             8,
+	})
+
+	for _, tc := range []struct {
+		name          string
+		entry         []byte
+		storeArtifact bool
+		expectHit     bool
+	}{
+		{name: "hit", entry: cached, storeArtifact: true, expectHit: true},
+		{name: "miss", entry: nil},
+		{name: "cached artifact was removed", entry: cached},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, api, store := newTestPlugin(t)
+			cfg := p.snapshot()
+			api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+			ctx := context.Background()
+			if tc.storeArtifact {
+				require.NoError(t, store.Put(ctx, "post-a/file-a/plan.esob", strings.NewReader("artifact"), 8))
+			}
+
+			api.On("KVGet", "cache-python-v1-hash").Return(tc.entry, nil)
+			api.On("KVSetWithOptions", "cache-python-v1-hash", []byte(nil), mock.Anything).Return(true, nil)
+			api.On("KVGet", "cachestats").Return(nil, nil)
+			var recorded kvstore.CacheStats
+			api.On("KVSetWithOptions", "cachestats", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				require.NoError(t, json.Unmarshal(args.Get(1).([]byte), &recorded))
+			}).Return(true, nil)
+
+			artifact := &kvstore.Artifact{
+				FileID:           "file-b",
+				PostID:           "post-b",
+				Key:              "post-b/file-b/plan.esob",
+				Converter:        "python",
+				ConverterVersion: "v1",
+				ContentHash:      "hash",
+			}
+			entry := p.reuseCachedArtifact(ctx, cfg, artifact)
+
+			if tc.expectHit {
+				require.NotNil(t, entry)
+				content, err := os.ReadFile(filepath.Join(store.Root(), "post-b", "file-b", "plan.esob"))
+				require.NoError(t, err)
+				assert.Equal(t, "artifact", string(content))
+				assert.Equal(t, kvstore.CacheStats{Hits: 1}, recorded)
+			} else {
+				assert.Nil(t, entry)
+				assert.Equal(t, kvstore.CacheStats{Misses: 1}, recorded)
+			}
+			if tc.entry != nil && !tc.storeArtifact {
+				api.AssertCalled(t, "KVSetWithOptions", "cache-python-v1-hash", []byte(nil), mock.Anything)
+			}
+		})
+	}
+}
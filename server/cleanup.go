@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+// diffFileIDs returns the files attached and detached between two versions of a post.
+func diffFileIDs(before, after []string) (added, removed []string) {
+	previous := make(map[string]bool, len(before))
+	for _, fileID := range before {
+		previous[fileID] = true
+	}
+	current := make(map[string]bool, len(after))
+	for _, fileID := range after {
+		current[fileID] = true
+		if !previous[fileID] {
+			added = append(added, fileID)
+		}
+	}
+	for _, fileID := range before {
+		if !current[fileID] {
+			removed = append(removed, fileID)
+		}
+	}
+	return added, removed
+}
+
+// cleanupRunner runs cleanup tasks in the background and holds their pending retries, so that
+// deactivation can stop them. Stopped tasks are resumed from the KV store on the next activation.
+type cleanupRunner struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+
+	// lock guards timers, and orders new runs against stop.
+	lock   sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newCleanupRunner() *cleanupRunner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &cleanupRunner{ctx: ctx, cancel: cancel, timers: map[string]*time.Timer{}}
+}
+
+// run starts fn in the background unless the runner was stopped.
+func (r *cleanupRunner) run(fn func(ctx context.Context)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.start(fn)
+}
+
+func (r *cleanupRunner) start(fn func(ctx context.Context)) {
+	if r.ctx.Err() != nil {
+		return
+	}
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		fn(r.ctx)
+	}()
+}
+
+// runAfter starts fn once the delay elapsed, replacing the pending retry of the same task.
+func (r *cleanupRunner) runAfter(taskID string, delay time.Duration, fn func(ctx context.Context)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.ctx.Err() != nil {
+		return
+	}
+	if pending, ok := r.timers[taskID]; ok {
+		pending.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if r.timers[taskID] == timer {
+			delete(r.timers, taskID)
+		}
+		r.start(fn)
+	})
+	r.timers[taskID] = timer
+}
+
+// stop cancels the running tasks, drops the pending retries and waits for the tasks to return.
+func (r *cleanupRunner) stop() {
+	r.lock.Lock()
+	r.cancel()
+	for taskID, timer := range r.timers {
+		timer.Stop()
+		delete(r.timers, taskID)
+	}
+	r.lock.Unlock()
+
+	r.running.Wait()
+}
+
+// scheduleArtifactRemoval persists a cleanup task for the files and runs it in the background,
+// so that the hook returns immediately.
+func (p *Plugin) scheduleArtifactRemoval(postID string, fileIDs []string, reason kvstore.CleanupReason) {
+	task := &kvstore.CleanupTask{
+		ID:        model.NewId(),
+		PostID:    postID,
+		FileIDs:   fileIDs,
+		Reason:    reason,
+		CreatedAt: model.GetMillis(),
+	}
+	if err := p.kvstore.SaveCleanupTask(task); err != nil {
+		// Artifacts of deleted posts are still reclaimed by the maintenance sweep.
+		p.API.LogError(".esob 파일 정리 작업 저장 실패", "postID", postID, "fileIDs", strings.Join(fileIDs, ","), "error", err.Error())
+		return
+	}
+	p.startCleanupTask(task.ID, 0)
+}
+
+// startCleanupTask runs the task once the delay elapsed. Nothing runs while the plugin is
+// inactive; the task is then resumed on the next activation.
+func (p *Plugin) startCleanupTask(taskID string, delay time.Duration) {
+	runner := p.cleanups.Load()
+	if runner == nil {
+		return
+	}
+	run := func(ctx context.Context) { p.runCleanupTask(ctx, taskID) }
+	if delay > 0 {
+		runner.runAfter(taskID, delay, run)
+	} else {
+		runner.run(run)
+	}
+}
+
+// resumeCleanupTasks restarts the cleanups that had not completed when the plugin last stopped.
+func (p *Plugin) resumeCleanupTasks() error {
+	tasks, err := p.kvstore.ListCleanupTasks()
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		var wait time.Duration
+		if task.NextAttemptAt > 0 {
+			wait = time.Until(time.UnixMilli(task.NextAttemptAt))
+		}
+		p.startCleanupTask(task.ID, wait)
+	}
+	if len(tasks) > 0 {
+		p.API.LogInfo("미완료 .esob 파일 정리 작업 재개", "count", len(tasks))
+	}
+	return nil
+}
+
+// runCleanupTask removes the artifacts of the task's files. Every step is idempotent, so a
+// failed task is simply run again after a backoff, up to MaxAttempts times. A completed task
+// leaves an audit record; so does one that ran out of attempts, which is dead-lettered that way.
+func (p *Plugin) runCleanupTask(ctx context.Context, taskID string) {
+	cfg := p.snapshot()
+	if cfg == nil {
+		// The plugin stopped; the task is resumed on the next activation.
+		return
+	}
+
+	// Every node resumes the pending tasks on activation; the mutex keeps them from running the
+	// same task at once.
+	mutex, err := cluster.NewMutex(p.API, "cleanup-"+taskID)
+	if err != nil {
+		p.API.LogError(".esob 파일 정리 작업 잠금 생성 실패", "taskID", taskID, "error", err.Error())
+		return
+	}
+	if err := mutex.LockWithContext(ctx); err != nil {
+		return
+	}
+	defer mutex.Unlock()
+
+	task, err := p.kvstore.GetCleanupTask(taskID)
+	if err != nil {
+		p.API.LogError(".esob 파일 정리 작업 조회 실패", "taskID", taskID, "error", err.Error())
+		p.startCleanupTask(taskID, cfg.RetryBaseDelay())
+		return
+	}
+	if task == nil {
+		// Another node completed it.
+		return
+	}
+
+	task.Attempts++
+	var failed error
+	for _, fileID := range task.FileIDs {
+		key, err := p.removeFileArtifacts(ctx, cfg, fileID)
+		if err != nil {
+			p.API.LogError(".esob 파일 삭제 실패", "postID", task.PostID, "fileID", fileID, "attempt", task.Attempts, "error", err.Error())
+			failed = err
+			continue
+		}
+		if key != "" && !slices.Contains(task.RemovedKeys, key) {
+			task.RemovedKeys = append(task.RemovedKeys, key)
+		}
+	}
+
+	if failed != nil && task.Attempts < cfg.MaxAttempts {
+		// The keys removed so far are saved with the task; a retry no longer finds them.
+		delay := retryDelay(task.Attempts, cfg.RetryBaseDelay(), cfg.RetryMaxDelay())
+		task.LastError = failed.Error()
+		task.NextAttemptAt = time.Now().Add(delay).UnixMilli()
+		if err := p.kvstore.SaveCleanupTask(task); err != nil {
+			p.API.LogError(".esob 파일 정리 작업 저장 실패", "taskID", task.ID, "error", err.Error())
+		}
+		p.API.LogInfo(".esob 파일 정리 재시도 예약", "taskID", task.ID, "delay", delay.String())
+		p.startCleanupTask(task.ID, delay)
+		return
+	}
+
+	record := &kvstore.AuditRecord{
+		ID:          task.ID,
+		PostID:      task.PostID,
+		FileIDs:     task.FileIDs,
+		Reason:      task.Reason,
+		RemovedKeys: task.RemovedKeys,
+		Attempts:    task.Attempts,
+		RequestedAt: task.CreatedAt,
+		CompletedAt: model.GetMillis(),
+	}
+	if failed != nil {
+		record.Error = failed.Error()
+	}
+	if err := p.kvstore.AddAuditRecord(record); err != nil {
+		p.API.LogError(".esob 파일 정리 감사 기록 저장 실패", "taskID", task.ID, "error", err.Error())
+	}
+	if err := p.kvstore.DeleteCleanupTask(task.ID); err != nil {
+		p.API.LogError(".esob 파일 정리 작업 삭제 실패", "taskID", task.ID, "error", err.Error())
+	}
+	if failed != nil {
+		p.API.LogWarn(".esob 파일 정리 최종 실패", "taskID", task.ID, "postID", task.PostID, "attempts", task.Attempts, "error", record.Error)
+		return
+	}
+	p.API.LogInfo(".esob 파일 정리 완료", "postID", task.PostID, "reason", task.Reason, "files", len(task.FileIDs), "removed", len(task.RemovedKeys))
+}
+
+// removeFileArtifacts deletes everything published for a file: its artifact, the cache entry
+// pointing at it, its manifest entry and its conversion status, and returns the key of the
+// removed artifact. Removing a file that has nothing left is not an error.
+func (p *Plugin) removeFileArtifacts(ctx context.Context, cfg *activeConfig, fileID string) (string, error) {
+	artifact, err := p.kvstore.GetArtifact(fileID)
+	if err != nil {
+		return "", err
+	}
+	if artifact == nil {
+		return "", p.kvstore.DeleteConversionStatus(fileID)
+	}
+
+	if err := cfg.artifacts.Delete(ctx, artifact.Key); err != nil {
+		return "", err
+	}
+	if err := p.forgetCachedArtifact(artifact); err != nil {
+		return "", err
+	}
+	// The manifest entry goes last: while it exists, a retry knows what to remove.
+	if err := p.kvstore.DeleteConversionStatus(fileID); err != nil {
+		return "", err
+	}
+	if err := p.kvstore.DeleteArtifact(fileID); err != nil {
+		return "", err
+	}
+	return artifact.Key, nil
+}
+
+// forgetCachedArtifact drops the cache entry of the artifact's content if it points at the
+// artifact, so that later uploads of the same content are converted again.
+func (p *Plugin) forgetCachedArtifact(artifact *kvstore.Artifact) error {
+	if artifact.ContentHash == "" {
+		return nil
+	}
+	entry, err := p.kvstore.GetCacheEntry(artifact.ContentHash, artifact.Converter, artifact.ConverterVersion)
+	if err != nil || entry == nil || entry.ArtifactKey != artifact.Key {
+		return err
+	}
+	return p.kvstore.DeleteCacheEntry(entry.ContentHash, entry.Converter, entry.ConverterVersion)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+func TestDiffFileIDs(t *testing.T) {
+	added, removed := diffFileIDs([]string{"a", "b", "c"}, []string{"c", "d", "a"})
+	assert.Equal(t, []string{"d"}, added)
+	assert.Equal(t, []string{"b"}, removed)
+
+	added, removed = diffFileIDs(nil, []string{"a"})
+	assert.Equal(t, []string{"a"}, added)
+	assert.Empty(t, removed)
+
+	added, removed = diffFileIDs([]string{"a", "b"}, []string{"b", "a"})
+	assert.Empty(t, added)
+	assert.Empty(t, removed)
+}
+
+func TestRemoveFileArtifacts(t *testing.T) {
+	p, api, store := newTestPlugin(t)
+	cfg := p.snapshot()
+
+	ctx := context.Background()
+	require.NoError(t, store.Put(ctx, "post/file/plan.esob", strings.NewReader("artifact"), 8))
+
+	artifact, _ := json.Marshal(&kvstore.Artifact{
+		FileID:           "file",
+		PostID:           "post",
+		Key:              "post/file/plan.esob",
+		Converter:        "python",
+		ConverterVersion: "v1",
+		ContentHash:      "hash",
+	})
+	entry, _ := json.Marshal(&kvstore.CacheEntry{ContentHash: "hash", Converter: "python", ConverterVersion: "v1", ArtifactKey: "post/file/plan.esob"})
+	api.On("KVGet", "artifact-file").Return(artifact, nil).Once()
+	api.On("KVGet", "artifact-file").Return(nil, nil)
+	api.On("KVGet", "cache-python-v1-hash").Return(entry, nil)
+	for _, key := range []string{"artifact-file", "cache-python-v1-hash", "conversion-file"} {
+		api.On("KVSetWithOptions", key, []byte(nil), mock.Anything).Return(true, nil)
+	}
+
+	key, err := p.removeFileArtifacts(ctx, cfg, "file")
+	require.NoError(t, err)
+	assert.Equal(t, "post/file/plan.esob", key)
+	assert.NoFileExists(t, filepath.Join(store.Root(), "post", "file", "plan.esob"))
+	api.AssertExpectations(t)
+
+	// Removing again finds nothing left and only clears the status.
+	key, err = p.removeFileArtifacts(ctx, cfg, "file")
+	require.NoError(t, err)
+	assert.Empty(t, key)
+}
+
+func TestRunCleanupTask(t *testing.T) {
+	p, api, store := newTestPlugin(t)
+	cfg := p.snapshot()
+	cfg.MaxAttempts = 3
+	cfg.RetryBaseDelaySeconds = 10
+	cfg.RetryMaxDelaySeconds = 600
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	ctx := context.Background()
+	require.NoError(t, store.Put(ctx, "post/file/plan.esob", strings.NewReader("artifact"), 8))
+
+	// The first attempt cannot clear the status; the second one can.
+	api.On("KVSetWithOptions", "conversion-file", []byte(nil), mock.Anything).Return(false, model.NewAppError("KVSetWithOptions", "store unavailable", nil, "", http.StatusInternalServerError)).Once()
+	kv := map[string][]byte{}
+	kvMemory(api, kv)
+	require.NoError(t, p.kvstore.SaveArtifact(&kvstore.Artifact{FileID: "file", PostID: "post", Key: "post/file/plan.esob"}))
+	require.NoError(t, p.kvstore.SaveCleanupTask(&kvstore.CleanupTask{ID: "task", PostID: "post", FileIDs: []string{"file"}, Reason: kvstore.CleanupReasonPostDeleted}))
+
+	p.runCleanupTask(ctx, "task")
+
+	saved, err := p.kvstore.GetCleanupTask("task")
+	require.NoError(t, err)
+	require.NotNil(t, saved)
+	assert.Equal(t, 1, saved.Attempts)
+	assert.NotZero(t, saved.NextAttemptAt, "the failed attempt is retried later")
+	assert.LessOrEqual(t, time.Until(time.UnixMilli(saved.NextAttemptAt)), cfg.RetryBaseDelay(), "the first retry waits the base delay")
+	assert.NotContains(t, kv, "audit-task")
+
+	p.runCleanupTask(ctx, "task")
+
+	var audit kvstore.AuditRecord
+	require.NoError(t, json.Unmarshal(kv["audit-task"], &audit))
+	assert.Equal(t, 2, audit.Attempts)
+	assert.Equal(t, kvstore.CleanupReasonPostDeleted, audit.Reason)
+	assert.Equal(t, []string{"post/file/plan.esob"}, audit.RemovedKeys)
+	assert.Empty(t, audit.Error)
+	assert.NotContains(t, kv, "cleanup-task")
+	assert.NoFileExists(t, filepath.Join(store.Root(), "post", "file", "plan.esob"))
+
+	// A task that ran already is not run again, e.g. by another node's pending retry.
+	p.runCleanupTask(ctx, "task")
+	assert.NotContains(t, kv, "cleanup-task")
+}
+
+func TestRunCleanupTaskDeadLetters(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	p.snapshot().MaxAttempts = 2
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	api.On("KVSetWithOptions", "conversion-file", []byte(nil), mock.Anything).Return(false, model.NewAppError("KVSetWithOptions", "store unavailable", nil, "", http.StatusInternalServerError))
+	kv := map[string][]byte{}
+	kvMemory(api, kv)
+	require.NoError(t, p.kvstore.SaveCleanupTask(&kvstore.CleanupTask{ID: "task", PostID: "post", FileIDs: []string{"file"}, Reason: kvstore.CleanupReasonFilesDetached}))
+
+	ctx := context.Background()
+	p.runCleanupTask(ctx, "task")
+	assert.Contains(t, kv, "cleanup-task")
+	p.runCleanupTask(ctx, "task")
+
+	assert.NotContains(t, kv, "cleanup-task", "a task out of attempts is no longer retried")
+	var audit kvstore.AuditRecord
+	require.NoError(t, json.Unmarshal(kv["audit-task"], &audit))
+	assert.Equal(t, 2, audit.Attempts)
+	assert.Contains(t, audit.Error, "store unavailable")
+	api.AssertNumberOfCalls(t, "LogWarn", 1)
+}
+
+func TestCleanupRunnerStop(t *testing.T) {
+	runner := newCleanupRunner()
+
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	runner.run(func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+	})
+	<-started
+
+	retried := make(chan struct{}, 1)
+	runner.runAfter("task", 20*time.Millisecond, func(context.Context) { retried <- struct{}{} })
+
+	runner.stop()
+	select {
+	case <-stopped:
+	default:
+		require.FailNow(t, "stop returned before the running task")
+	}
+	assert.Empty(t, runner.timers)
+
+	runner.run(func(context.Context) { retried <- struct{}{} })
+	select {
+	case <-retried:
+		assert.Fail(t, "a task ran after stop")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
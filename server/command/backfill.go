@@ -0,0 +1,121 @@
+package command
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+// BackfillDateLayout is the format of the date a backfill starts from.
+const BackfillDateLayout = "2006-01-02"
+
+// BackfillRequest asks for the attachments of a team or a channel posted since a date to be
+// converted.
+type BackfillRequest struct {
+	UserID    string
+	TeamID    string
+	ChannelID string
+	Since     time.Time
+	// ReplyChannelID is where progress is posted to the requester; empty for no progress posts.
+	ReplyChannelID string
+}
+
+// BackfillService runs backfills on behalf of the /collabview command. It is implemented by the plugin.
+type BackfillService interface {
+	// StartBackfill checkpoints a new backfill and starts walking its channels in the background.
+	StartBackfill(request BackfillRequest) (*kvstore.Backfill, error)
+	// GetBackfill returns the backfill with the given ID, or nil if it does not exist.
+	GetBackfill(backfillID string) (*kvstore.Backfill, error)
+	// CancelBackfill stops a running backfill and returns it, or nil if it does not exist.
+	CancelBackfill(backfillID string) (*kvstore.Backfill, error)
+}
+
+func newBackfillAutocompleteData() *model.AutocompleteData {
+	backfill := model.NewAutocompleteData("backfill", "[channel|team|status|cancel]", "Convert the attachments posted before the plugin was installed")
+	backfill.RoleID = model.SystemAdminRoleId
+
+	channel := model.NewAutocompleteData("channel", "[YYYY-MM-DD]", "Convert the attachments of this channel posted since a date")
+	channel.AddTextArgument("Date of the oldest posts to convert, in UTC", "[YYYY-MM-DD]", "")
+	team := model.NewAutocompleteData("team", "[YYYY-MM-DD]", "Convert the attachments of this team's channels posted since a date")
+	team.AddTextArgument("Date of the oldest posts to convert, in UTC", "[YYYY-MM-DD]", "")
+	status := model.NewAutocompleteData("status", "[backfill ID]", "Show the progress of a backfill")
+	status.AddTextArgument("ID of the backfill", "[backfill ID]", "")
+	cancel := model.NewAutocompleteData("cancel", "[backfill ID]", "Stop a running backfill")
+	cancel.AddTextArgument("ID of the backfill", "[backfill ID]", "")
+
+	backfill.AddCommand(channel)
+	backfill.AddCommand(team)
+	backfill.AddCommand(status)
+	backfill.AddCommand(cancel)
+	return backfill
+}
+
+func (c *Handler) executeBackfillCommand(args *model.CommandArgs, params []string) *model.CommandResponse {
+	if !c.client.User.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return ephemeral("Only system admins can run backfills.")
+	}
+	if len(params) < 2 {
+		return ephemeral("Usage: `/collabview backfill channel|team YYYY-MM-DD` or `/collabview backfill status|cancel <backfill ID>`")
+	}
+
+	switch params[0] {
+	case "channel", "team":
+		since, err := time.Parse(BackfillDateLayout, params[1])
+		if err != nil {
+			return ephemeral(fmt.Sprintf("Invalid date %q, expected YYYY-MM-DD.", params[1]))
+		}
+		request := BackfillRequest{UserID: args.UserId, Since: since, ReplyChannelID: args.ChannelId}
+		if params[0] == "channel" {
+			request.ChannelID = args.ChannelId
+		} else {
+			request.TeamID = args.TeamId
+		}
+
+		backfill, err := c.backfills.StartBackfill(request)
+		if err != nil {
+			return ephemeral("Failed to start the backfill: " + err.Error())
+		}
+		return ephemeral(fmt.Sprintf("Backfill `%s` started for %d channel(s). Progress will be posted here; check it any time with `/collabview backfill status %s`.",
+			backfill.ID, len(backfill.ChannelIDs), backfill.ID))
+	case "status":
+		backfill, err := c.backfills.GetBackfill(params[1])
+		if err != nil {
+			return ephemeral("Failed to get the backfill: " + err.Error())
+		}
+		if backfill == nil {
+			return ephemeral(fmt.Sprintf("Backfill `%s` not found.", params[1]))
+		}
+		return ephemeral(BackfillSummary(backfill, time.Now()))
+	case "cancel":
+		backfill, err := c.backfills.CancelBackfill(params[1])
+		if err != nil {
+			return ephemeral("Failed to cancel the backfill: " + err.Error())
+		}
+		if backfill == nil {
+			return ephemeral(fmt.Sprintf("Backfill `%s` not found.", params[1]))
+		}
+		return ephemeral(BackfillSummary(backfill, time.Now()))
+	default:
+		return ephemeral(fmt.Sprintf("Unknown backfill command: %s", params[0]))
+	}
+}
+
+// BackfillSummary describes the progress of a backfill to its requester.
+func BackfillSummary(backfill *kvstore.Backfill, now time.Time) string {
+	text := fmt.Sprintf("Backfill `%s` is %s: %.0f%% of %d channel(s) done, %d post(s) with %d attachment(s) checked, %d queued for conversion.",
+		backfill.ID, backfill.State, backfill.Progress()*100, len(backfill.ChannelIDs), backfill.Posts, backfill.Files, backfill.Enqueued)
+	if !backfill.IsFinished() {
+		if eta := backfill.ETA(now); eta > 0 {
+			text += fmt.Sprintf(" About %s left.", eta.Round(time.Second))
+		} else {
+			text += " Estimating the remaining time."
+		}
+	}
+	if backfill.Errors > 0 {
+		text += fmt.Sprintf(" %d error(s), the last one: %s", backfill.Errors, backfill.LastError)
+	}
+	return text
+}
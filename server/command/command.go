@@ -9,39 +9,74 @@ import (
 )
 
 type Handler struct {
-	client *pluginapi.Client
+	client      *pluginapi.Client
+	conversions ConversionService
+	backfills   BackfillService
 }
 
 type Command interface {
 	Handle(args *model.CommandArgs) (*model.CommandResponse, error)
-	executeHelloCommand(args *model.CommandArgs) *model.CommandResponse
+	executeCollabviewCommand(args *model.CommandArgs) *model.CommandResponse
 }
 
-const helloCommandTrigger = "hello"
+const collabviewCommandTrigger = "collabview"
+
+const helpText = "###### Collabview commands\n" +
+	"- `/collabview status <file|post link>`: Show the conversion status of a file or of every file of a post\n" +
+	"- `/collabview retry <file>`: Convert a file again\n" +
+	"- `/collabview convert [post link]`: Convert the files of this thread's post, or of the linked post, that are not converted yet\n" +
+	"- `/collabview open <file>`: Get a link opening a converted file in Collabview\n" +
+	"- `/collabview backfill channel|team|status|cancel`: Convert the attachments posted before the plugin was installed (system admins)\n" +
+	"- `/collabview help`: Show this help\n\n" +
+	"A file is given by its ID or link, a post by its ID or permalink."
 
 // Register all your slash commands in the NewCommandHandler function.
-func NewCommandHandler(client *pluginapi.Client) Command {
+func NewCommandHandler(client *pluginapi.Client, conversions ConversionService, backfills BackfillService) Command {
 	err := client.SlashCommand.Register(&model.Command{
-		Trigger:          helloCommandTrigger,
+		Trigger:          collabviewCommandTrigger,
 		AutoComplete:     true,
-		AutoCompleteDesc: "Say hello to someone",
-		AutoCompleteHint: "[@username]",
-		AutocompleteData: model.NewAutocompleteData(helloCommandTrigger, "[@username]", "Username to say hello to"),
+		AutoCompleteDesc: "Manage Collabview document conversions",
+		AutoCompleteHint: "[command]",
+		AutocompleteData: newCollabviewAutocompleteData(),
 	})
 	if err != nil {
 		client.Log.Error("Failed to register command", "error", err)
 	}
 	return &Handler{
-		client: client,
+		client:      client,
+		conversions: conversions,
+		backfills:   backfills,
 	}
 }
 
+func newCollabviewAutocompleteData() *model.AutocompleteData {
+	collabview := model.NewAutocompleteData(collabviewCommandTrigger, "[command]", "Available commands: status, retry, convert, open, backfill, help")
+
+	status := model.NewAutocompleteData("status", "<file|post link>", "Show the conversion status of a file or of every file of a post")
+	status.AddTextArgument("ID or link of a file or a post", "<file|post link>", "")
+	retry := model.NewAutocompleteData("retry", "<file>", "Convert a file again")
+	retry.AddTextArgument("ID or link of the file", "<file>", "")
+	convert := model.NewAutocompleteData("convert", "[post link]", "Convert the files of this thread's post that are not converted yet")
+	convert.AddTextArgument("ID or permalink of another post", "[post link]", "")
+	open := model.NewAutocompleteData("open", "<file>", "Get a link opening a converted file in Collabview")
+	open.AddTextArgument("ID or link of the file", "<file>", "")
+	help := model.NewAutocompleteData("help", "", "Show the available commands")
+
+	collabview.AddCommand(status)
+	collabview.AddCommand(retry)
+	collabview.AddCommand(convert)
+	collabview.AddCommand(open)
+	collabview.AddCommand(newBackfillAutocompleteData())
+	collabview.AddCommand(help)
+	return collabview
+}
+
 // ExecuteCommand hook calls this method to execute the commands that were registered in the NewCommandHandler function.
 func (c *Handler) Handle(args *model.CommandArgs) (*model.CommandResponse, error) {
 	trigger := strings.TrimPrefix(strings.Fields(args.Command)[0], "/")
 	switch trigger {
-	case helloCommandTrigger:
-		return c.executeHelloCommand(args), nil
+	case collabviewCommandTrigger:
+		return c.executeCollabviewCommand(args), nil
 	default:
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
@@ -50,15 +85,34 @@ func (c *Handler) Handle(args *model.CommandArgs) (*model.CommandResponse, error
 	}
 }
 
-func (c *Handler) executeHelloCommand(args *model.CommandArgs) *model.CommandResponse {
-	if len(strings.Fields(args.Command)) < 2 {
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Please specify a username",
-		}
+func (c *Handler) executeCollabviewCommand(args *model.CommandArgs) *model.CommandResponse {
+	fields := strings.Fields(args.Command)
+	if len(fields) < 2 {
+		return ephemeral(helpText)
+	}
+
+	params := fields[2:]
+	switch fields[1] {
+	case "status":
+		return c.executeStatusCommand(args, params)
+	case "retry":
+		return c.executeRetryCommand(args, params)
+	case "convert":
+		return c.executeConvertCommand(args, params)
+	case "open":
+		return c.executeOpenCommand(args, params)
+	case "backfill":
+		return c.executeBackfillCommand(args, params)
+	case "help":
+		return ephemeral(helpText)
+	default:
+		return ephemeral(fmt.Sprintf("Unknown command: %s\n\n%s", fields[1], helpText))
 	}
-	username := strings.Fields(args.Command)[1]
+}
+
+func ephemeral(text string) *model.CommandResponse {
 	return &model.CommandResponse{
-		Text: "Hello, " + username,
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         text,
 	}
 }
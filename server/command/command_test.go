@@ -1,12 +1,18 @@
 package command
 
 import (
+	"errors"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
 	"github.com/mattermost/mattermost/server/public/pluginapi"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
 )
 
 type env struct {
@@ -25,23 +31,229 @@ func setupTest() *env {
 	}
 }
 
-func TestHelloCommand(t *testing.T) {
-	assert := assert.New(t)
+func TestCollabviewCommand(t *testing.T) {
 	env := setupTest()
+	env.api.On("RegisterCommand", mock.MatchedBy(func(cmd *model.Command) bool {
+		if cmd.Trigger != collabviewCommandTrigger || !cmd.AutoComplete {
+			return false
+		}
+		var subcommands []string
+		for _, subcommand := range cmd.AutocompleteData.SubCommands {
+			subcommands = append(subcommands, subcommand.Trigger)
+		}
+		return assert.Equal(t, []string{"status", "retry", "convert", "open", "backfill", "help"}, subcommands)
+	})).Return(nil).Once()
+	cmdHandler := NewCommandHandler(env.client, &fakeConversions{}, &fakeBackfills{})
+	env.api.AssertExpectations(t)
+
+	for _, command := range []string{"/collabview", "/collabview help"} {
+		response, err := cmdHandler.Handle(&model.CommandArgs{Command: command})
+		assert.NoError(t, err)
+		assert.Equal(t, model.CommandResponseTypeEphemeral, response.ResponseType)
+		assert.Equal(t, helpText, response.Text)
+	}
+
+	response, err := cmdHandler.Handle(&model.CommandArgs{Command: "/collabview frobnicate"})
+	assert.NoError(t, err)
+	assert.Contains(t, response.Text, "Unknown command: frobnicate")
+}
+
+func TestParseReference(t *testing.T) {
+	id := model.NewId()
+	for _, tc := range []struct {
+		arg  string
+		kind referenceKind
+		ok   bool
+	}{
+		{id, referenceAny, true},
+		{"https://chat.example.com/team/pl/" + id, referencePost, true},
+		{"https://chat.example.com/files/" + id + "/public?h=hash", referenceFile, true},
+		{"https://chat.example.com/api/v4/files/" + id, referenceFile, true},
+		{"<https://chat.example.com/team/pl/" + id + ">", referencePost, true},
+		{"not-an-id", referenceAny, false},
+		{"https://chat.example.com/team/pl/short", referencePost, false},
+	} {
+		t.Run(tc.arg, func(t *testing.T) {
+			parsed, kind, ok := parseReference(tc.arg)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.kind, kind)
+			if tc.ok {
+				assert.Equal(t, id, parsed)
+			}
+		})
+	}
+}
+
+// fakeConversions records the requests of the conversion commands.
+type fakeConversions struct {
+	statuses map[string]*kvstore.ConversionStatus
+	retried  []string
+	queued   int
+	links    map[string]string
+}
+
+func (f *fakeConversions) GetConversionStatus(fileID string) (*kvstore.ConversionStatus, error) {
+	return f.statuses[fileID], nil
+}
+
+func (f *fakeConversions) RetryConversion(fileID string) (*kvstore.Job, error) {
+	f.retried = append(f.retried, fileID)
+	return &kvstore.Job{}, nil
+}
+
+func (f *fakeConversions) ConvertPost(string) (int, error) {
+	return f.queued, nil
+}
+
+func (f *fakeConversions) ViewerLink(userID, fileID string) (string, error) {
+	link, ok := f.links[fileID]
+	if !ok {
+		return "", errors.New("file has not been converted")
+	}
+	return link + "?user=" + userID, nil
+}
+
+func TestConversionCommands(t *testing.T) {
+	var (
+		postID     = model.NewId()
+		docID      = model.NewId()
+		imageID    = model.NewId()
+		draftID    = model.NewId()
+		privateID  = model.NewId()
+		unknownID  = model.NewId()
+		channelID  = "channel"
+		privateCh  = "private"
+		uploaderID = "uploader"
+	)
+
+	env := setupTest()
+	env.api.On("RegisterCommand", mock.Anything).Return(nil)
+	env.api.On("GetFileInfo", docID).Return(&model.FileInfo{Id: docID, Name: "plan.docx", PostId: postID, CreatorId: uploaderID}, nil)
+	env.api.On("GetFileInfo", imageID).Return(&model.FileInfo{Id: imageID, Name: "photo.png", PostId: postID, CreatorId: uploaderID}, nil)
+	env.api.On("GetFileInfo", draftID).Return(&model.FileInfo{Id: draftID, Name: "draft.pptx", CreatorId: uploaderID}, nil)
+	env.api.On("GetFileInfo", privateID).Return(&model.FileInfo{Id: privateID, Name: "secret.xlsx", PostId: "privatepost", CreatorId: "someone"}, nil)
+	env.api.On("GetFileInfo", mock.Anything).Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+	env.api.On("GetPost", postID).Return(&model.Post{Id: postID, ChannelId: channelID, FileIds: []string{docID, imageID}}, nil)
+	env.api.On("GetPost", "privatepost").Return(&model.Post{Id: "privatepost", ChannelId: privateCh, FileIds: []string{privateID}}, nil)
+	env.api.On("GetPost", mock.Anything).Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+	env.api.On("HasPermissionToChannel", mock.Anything, channelID, model.PermissionReadChannel).Return(true)
+	env.api.On("HasPermissionToChannel", mock.Anything, privateCh, model.PermissionReadChannel).Return(false)
+	env.api.On("HasPermissionToChannel", "reader", channelID, model.PermissionCreatePost).Return(false)
+	env.api.On("HasPermissionToChannel", mock.Anything, channelID, model.PermissionCreatePost).Return(true)
+	env.api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	env.api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(false)
+
+	conversions := &fakeConversions{
+		statuses: map[string]*kvstore.ConversionStatus{
+			docID:   {FileID: docID, State: kvstore.ConversionStateSucceeded, Converter: "python", ArtifactKey: "artifact", DurationMs: 1500, CacheHit: true},
+			imageID: {FileID: imageID, State: kvstore.ConversionStateFailed, Error: "unsupported"},
+		},
+		queued: 1,
+		links:  map[string]string{docID: "https://chat.example.com/open"},
+	}
+	cmdHandler := NewCommandHandler(env.client, conversions, &fakeBackfills{})
+	run := func(userID, rootID, command string) string {
+		response, err := cmdHandler.Handle(&model.CommandArgs{UserId: userID, ChannelId: channelID, RootId: rootID, Command: command})
+		assert.NoError(t, err)
+		assert.Equal(t, model.CommandResponseTypeEphemeral, response.ResponseType)
+		return response.Text
+	}
+
+	t.Run("status", func(t *testing.T) {
+		assert.Contains(t, run("reader", "", "/collabview status"), "Usage")
+		assert.Equal(t, "**plan.docx**: converted by python in 1.5s (from the cache)", run("reader", "", "/collabview status "+docID))
+		assert.Equal(t, "- **plan.docx**: converted by python in 1.5s (from the cache)\n- **photo.png**: failed: unsupported",
+			run("reader", "", "/collabview status https://chat.example.com/team/pl/"+postID))
+		assert.Contains(t, run("reader", "", "/collabview status "+postID), "**photo.png**: failed", "a bare post ID")
+		assert.Equal(t, "**draft.pptx**: not converted", run(uploaderID, "", "/collabview status "+draftID))
+		assert.Contains(t, run("reader", "", "/collabview status "+draftID), "not found", "unposted files are private")
+		assert.Contains(t, run("reader", "", "/collabview status "+privateID), "not found", "files of unreadable channels are hidden")
+		assert.Contains(t, run("reader", "", "/collabview status "+unknownID), "not found")
+		assert.Contains(t, run("reader", "", "/collabview status nonsense"), "Invalid")
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		assert.Contains(t, run("reader", "", "/collabview retry "+docID), "Only the uploader")
+		assert.Contains(t, run("reader", "", "/collabview retry "+privateID), "not found")
+		assert.Empty(t, conversions.retried)
+
+		assert.Contains(t, run(uploaderID, "", "/collabview retry "+docID), "**plan.docx** is queued for conversion again")
+		assert.Contains(t, run("admin", "", "/collabview retry https://chat.example.com/files/"+imageID+"/public"), "queued")
+		assert.Equal(t, []string{docID, imageID}, conversions.retried)
+	})
+
+	t.Run("convert", func(t *testing.T) {
+		assert.Contains(t, run("reader", "", "/collabview convert"), "from the thread of a post")
+		assert.Contains(t, run("reader", postID, "/collabview convert"), "You need permission to post")
+		assert.Equal(t, "Queued 1 of 2 attachment(s) for conversion.", run(uploaderID, postID, "/collabview convert"))
+		assert.Contains(t, run(uploaderID, "", "/collabview convert https://chat.example.com/team/pl/"+postID), "Queued 1 of 2")
+		assert.Contains(t, run(uploaderID, "", "/collabview convert https://chat.example.com/files/"+docID), "Invalid post")
+	})
+
+	t.Run("open", func(t *testing.T) {
+		assert.Contains(t, run("reader", "", "/collabview open "+docID), "[Open **plan.docx** in Collabview](https://chat.example.com/open?user=reader)")
+		assert.Contains(t, run("reader", "", "/collabview open "+imageID), "Cannot open **photo.png**: file has not been converted")
+		assert.Contains(t, run("reader", "", "/collabview open "+privateID), "not found")
+		assert.Contains(t, run("reader", "", "/collabview open https://chat.example.com/team/pl/"+postID), "Invalid file")
+	})
+}
+
+// fakeBackfills records the requests of the backfill command.
+type fakeBackfills struct {
+	requests  []BackfillRequest
+	backfills map[string]*kvstore.Backfill
+}
+
+func (f *fakeBackfills) StartBackfill(request BackfillRequest) (*kvstore.Backfill, error) {
+	f.requests = append(f.requests, request)
+	return &kvstore.Backfill{ID: "backfill", ChannelIDs: []string{"channel"}, State: kvstore.BackfillStateRunning}, nil
+}
+
+func (f *fakeBackfills) GetBackfill(backfillID string) (*kvstore.Backfill, error) {
+	return f.backfills[backfillID], nil
+}
+
+func (f *fakeBackfills) CancelBackfill(backfillID string) (*kvstore.Backfill, error) {
+	backfill := f.backfills[backfillID]
+	if backfill != nil {
+		backfill.State = kvstore.BackfillStateCanceled
+	}
+	return backfill, nil
+}
+
+func TestBackfillCommand(t *testing.T) {
+	env := setupTest()
+	env.api.On("RegisterCommand", mock.Anything).Return(nil)
+	env.api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	env.api.On("HasPermissionTo", "user", model.PermissionManageSystem).Return(false)
+
+	backfills := &fakeBackfills{backfills: map[string]*kvstore.Backfill{
+		"running": {ID: "running", ChannelIDs: []string{"a", "b"}, State: kvstore.BackfillStateRunning, ChannelIndex: 1, Posts: 12, Files: 20, Enqueued: 7},
+	}}
+	cmdHandler := NewCommandHandler(env.client, &fakeConversions{}, backfills)
+	run := func(userID, command string) string {
+		response, err := cmdHandler.Handle(&model.CommandArgs{UserId: userID, TeamId: "team", ChannelId: "channel", Command: command})
+		assert.NoError(t, err)
+		assert.Equal(t, model.CommandResponseTypeEphemeral, response.ResponseType)
+		return response.Text
+	}
+
+	assert.Contains(t, run("user", "/collabview backfill channel 2020-01-01"), "Only system admins")
+	assert.Empty(t, backfills.requests)
+
+	assert.Contains(t, run("admin", "/collabview backfill channel 2020-13-01"), "Invalid date")
+
+	assert.Contains(t, run("admin", "/collabview backfill channel 2020-01-01"), "Backfill `backfill` started for 1 channel(s)")
+	assert.Contains(t, run("admin", "/collabview backfill team 2021-06-15"), "started")
+	if assert.Len(t, backfills.requests, 2) {
+		assert.Equal(t, BackfillRequest{UserID: "admin", ChannelID: "channel", Since: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ReplyChannelID: "channel"}, backfills.requests[0])
+		assert.Equal(t, BackfillRequest{UserID: "admin", TeamID: "team", Since: time.Date(2021, 6, 15, 0, 0, 0, 0, time.UTC), ReplyChannelID: "channel"}, backfills.requests[1])
+	}
+
+	status := run("admin", "/collabview backfill status running")
+	assert.Contains(t, status, "is running: 50% of 2 channel(s) done")
+	assert.Contains(t, status, "7 queued")
+	assert.Contains(t, run("admin", "/collabview backfill status missing"), "not found")
 
-	env.api.On("RegisterCommand", &model.Command{
-		Trigger:          helloCommandTrigger,
-		AutoComplete:     true,
-		AutoCompleteDesc: "Say hello to someone",
-		AutoCompleteHint: "[@username]",
-		AutocompleteData: model.NewAutocompleteData("hello", "[@username]", "Username to say hello to"),
-	}).Return(nil)
-	cmdHandler := NewCommandHandler(env.client)
-
-	args := &model.CommandArgs{
-		Command: "/hello world",
-	}
-	response, err := cmdHandler.Handle(args)
-	assert.Nil(err)
-	assert.Equal("Hello, world", response.Text)
+	assert.Contains(t, run("admin", "/collabview backfill cancel running"), "is canceled")
 }
@@ -0,0 +1,249 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+	"github.com/pkg/errors"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+// ConversionService runs conversions on behalf of the /collabview command. It is implemented by the plugin.
+type ConversionService interface {
+	// GetConversionStatus returns the conversion status of a file, or nil if it was never queued.
+	GetConversionStatus(fileID string) (*kvstore.ConversionStatus, error)
+	// RetryConversion queues a file for conversion again, replacing its previous artifact.
+	RetryConversion(fileID string) (*kvstore.Job, error)
+	// ConvertPost queues the files of a post that have no usable artifact and returns how many were queued.
+	ConvertPost(postID string) (int, error)
+	// ViewerLink returns a short-lived link opening the artifact of a converted file for a user.
+	ViewerLink(userID, fileID string) (string, error)
+}
+
+type referenceKind int
+
+const (
+	referenceAny referenceKind = iota
+	referenceFile
+	referencePost
+)
+
+// parseReference extracts the ID from a file link, a post permalink or a bare ID, which may name
+// either a file or a post.
+func parseReference(arg string) (string, referenceKind, bool) {
+	arg = strings.Trim(arg, "<>")
+	for _, link := range []struct {
+		marker string
+		kind   referenceKind
+	}{{"/pl/", referencePost}, {"/files/", referenceFile}} {
+		i := strings.Index(arg, link.marker)
+		if i < 0 {
+			continue
+		}
+		id := arg[i+len(link.marker):]
+		if end := strings.IndexAny(id, "/?#"); end >= 0 {
+			id = id[:end]
+		}
+		return id, link.kind, model.IsValidId(id)
+	}
+	return arg, referenceAny, model.IsValidId(arg)
+}
+
+func (c *Handler) executeStatusCommand(args *model.CommandArgs, params []string) *model.CommandResponse {
+	if len(params) != 1 {
+		return ephemeral("Usage: `/collabview status <file|post link>`")
+	}
+	id, kind, ok := parseReference(params[0])
+	if !ok {
+		return ephemeral(fmt.Sprintf("Invalid file or post: %s", params[0]))
+	}
+
+	if kind != referencePost {
+		fileInfo, err := c.client.File.GetInfo(id)
+		switch {
+		case err == nil:
+			if _, failure := c.readablePostOf(args.UserId, fileInfo); failure != nil {
+				return failure
+			}
+			return ephemeral(c.fileStatus(fileInfo))
+		case !errors.Is(err, pluginapi.ErrNotFound):
+			return ephemeral("Failed to get the file: " + err.Error())
+		case kind == referenceFile:
+			return ephemeral(fmt.Sprintf("File `%s` not found.", id))
+		}
+	}
+
+	post, failure := c.readablePost(args.UserId, id)
+	if failure != nil {
+		return failure
+	}
+	if len(post.FileIds) == 0 {
+		return ephemeral("The post has no attachments.")
+	}
+
+	lines := make([]string, 0, len(post.FileIds))
+	for _, fileID := range post.FileIds {
+		fileInfo, err := c.client.File.GetInfo(fileID)
+		if err != nil {
+			fileInfo = &model.FileInfo{Id: fileID, Name: fileID}
+		}
+		lines = append(lines, "- "+c.fileStatus(fileInfo))
+	}
+	return ephemeral(strings.Join(lines, "\n"))
+}
+
+func (c *Handler) executeRetryCommand(args *model.CommandArgs, params []string) *model.CommandResponse {
+	if len(params) != 1 {
+		return ephemeral("Usage: `/collabview retry <file>`")
+	}
+	fileInfo, failure := c.readableFile(args.UserId, params[0])
+	if failure != nil {
+		return failure
+	}
+	if fileInfo.CreatorId != args.UserId && !c.client.User.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return ephemeral("Only the uploader of the file or a system admin can convert it again.")
+	}
+
+	if _, err := c.conversions.RetryConversion(fileInfo.Id); err != nil {
+		return ephemeral(fmt.Sprintf("Failed to convert **%s** again: %s", fileInfo.Name, err.Error()))
+	}
+	return ephemeral(fmt.Sprintf("**%s** is queued for conversion again. Check it with `/collabview status %s`.", fileInfo.Name, fileInfo.Id))
+}
+
+func (c *Handler) executeConvertCommand(args *model.CommandArgs, params []string) *model.CommandResponse {
+	if len(params) > 1 {
+		return ephemeral("Usage: `/collabview convert [post link]`")
+	}
+	postID := args.RootId
+	if len(params) == 1 {
+		id, kind, ok := parseReference(params[0])
+		if !ok || kind == referenceFile {
+			return ephemeral(fmt.Sprintf("Invalid post: %s", params[0]))
+		}
+		postID = id
+	}
+	if postID == "" {
+		return ephemeral("Run `/collabview convert` from the thread of a post, or give a post link.")
+	}
+
+	post, failure := c.readablePost(args.UserId, postID)
+	if failure != nil {
+		return failure
+	}
+	if !c.client.User.HasPermissionToChannel(args.UserId, post.ChannelId, model.PermissionCreatePost) {
+		return ephemeral("You need permission to post in the channel to convert its files.")
+	}
+	if len(post.FileIds) == 0 {
+		return ephemeral("The post has no attachments.")
+	}
+
+	queued, err := c.conversions.ConvertPost(post.Id)
+	if err != nil {
+		return ephemeral(fmt.Sprintf("Queued %d attachment(s) for conversion, but some failed: %s", queued, err.Error()))
+	}
+	if queued == 0 {
+		return ephemeral(fmt.Sprintf("All %d attachment(s) of the post are already converted or being converted.", len(post.FileIds)))
+	}
+	return ephemeral(fmt.Sprintf("Queued %d of %d attachment(s) for conversion.", queued, len(post.FileIds)))
+}
+
+func (c *Handler) executeOpenCommand(args *model.CommandArgs, params []string) *model.CommandResponse {
+	if len(params) != 1 {
+		return ephemeral("Usage: `/collabview open <file>`")
+	}
+	fileInfo, failure := c.readableFile(args.UserId, params[0])
+	if failure != nil {
+		return failure
+	}
+
+	link, err := c.conversions.ViewerLink(args.UserId, fileInfo.Id)
+	if err != nil {
+		return ephemeral(fmt.Sprintf("Cannot open **%s**: %s", fileInfo.Name, err.Error()))
+	}
+	return ephemeral(fmt.Sprintf("[Open **%s** in Collabview](%s)\nThe link is only for you, works once and expires shortly.", fileInfo.Name, link))
+}
+
+// readableFile resolves a file reference and checks that the user can read it.
+func (c *Handler) readableFile(userID, arg string) (*model.FileInfo, *model.CommandResponse) {
+	id, kind, ok := parseReference(arg)
+	if !ok || kind == referencePost {
+		return nil, ephemeral(fmt.Sprintf("Invalid file: %s", arg))
+	}
+
+	fileInfo, err := c.client.File.GetInfo(id)
+	if errors.Is(err, pluginapi.ErrNotFound) {
+		return nil, ephemeral(fmt.Sprintf("File `%s` not found.", id))
+	}
+	if err != nil {
+		return nil, ephemeral("Failed to get the file: " + err.Error())
+	}
+	if _, failure := c.readablePostOf(userID, fileInfo); failure != nil {
+		return nil, failure
+	}
+	return fileInfo, nil
+}
+
+// readablePostOf checks that the user can read the post a file is attached to. A file that is
+// not posted yet is only visible to its uploader.
+func (c *Handler) readablePostOf(userID string, fileInfo *model.FileInfo) (*model.Post, *model.CommandResponse) {
+	if fileInfo.PostId == "" {
+		if fileInfo.CreatorId != userID {
+			return nil, ephemeral(fmt.Sprintf("File `%s` not found.", fileInfo.Id))
+		}
+		return nil, nil
+	}
+	return c.readablePost(userID, fileInfo.PostId)
+}
+
+// readablePost loads a post the user can read. Posts of channels the user cannot read are
+// reported as missing so that their existence is not disclosed.
+func (c *Handler) readablePost(userID, postID string) (*model.Post, *model.CommandResponse) {
+	post, err := c.client.Post.GetPost(postID)
+	if errors.Is(err, pluginapi.ErrNotFound) || (err == nil && post.DeleteAt != 0) {
+		return nil, ephemeral(fmt.Sprintf("Post `%s` not found.", postID))
+	}
+	if err != nil {
+		return nil, ephemeral("Failed to get the post: " + err.Error())
+	}
+	if !c.client.User.HasPermissionToChannel(userID, post.ChannelId, model.PermissionReadChannel) {
+		return nil, ephemeral(fmt.Sprintf("Post `%s` not found.", postID))
+	}
+	return post, nil
+}
+
+// fileStatus describes the conversion status of a file in one line.
+func (c *Handler) fileStatus(fileInfo *model.FileInfo) string {
+	status, err := c.conversions.GetConversionStatus(fileInfo.Id)
+	if err != nil {
+		return fmt.Sprintf("**%s**: failed to get the status: %s", fileInfo.Name, err.Error())
+	}
+	if status == nil {
+		return fmt.Sprintf("**%s**: not converted", fileInfo.Name)
+	}
+
+	switch status.State {
+	case kvstore.ConversionStateQueued:
+		return fmt.Sprintf("**%s**: queued", fileInfo.Name)
+	case kvstore.ConversionStateRunning:
+		return fmt.Sprintf("**%s**: converting with %s", fileInfo.Name, status.Converter)
+	case kvstore.ConversionStateSucceeded:
+		if status.ArtifactKey == "" {
+			return fmt.Sprintf("**%s**: skipped, not a document type that is converted", fileInfo.Name)
+		}
+		text := fmt.Sprintf("**%s**: converted by %s in %s", fileInfo.Name, status.Converter, (time.Duration(status.DurationMs) * time.Millisecond).Round(time.Millisecond))
+		if status.CacheHit {
+			text += " (from the cache)"
+		}
+		return text
+	case kvstore.ConversionStateFailed:
+		return fmt.Sprintf("**%s**: failed: %s", fileInfo.Name, status.Error)
+	case kvstore.ConversionStateExpired:
+		return fmt.Sprintf("**%s**: expired, the converted file was removed after the retention period", fileInfo.Name)
+	default:
+		return fmt.Sprintf("**%s**: %s", fileInfo.Name, status.State)
+	}
+}
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/mattermost/mattermost-plugin-starter-template/server/command (interfaces: Command)
+// Source: github.com/jyoonje/collabview_plugin/server/command (interfaces: Command)
 
 // Package mocks is a generated GoMock package.
 package mocks
@@ -35,11 +35,11 @@ func (m *MockCommand) EXPECT() *MockCommandMockRecorder {
 }
 
 // Handle mocks base method.
-func (m *MockCommand) Handle(arg0 *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+func (m *MockCommand) Handle(arg0 *model.CommandArgs) (*model.CommandResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Handle", arg0)
 	ret0, _ := ret[0].(*model.CommandResponse)
-	ret1, _ := ret[1].(*model.AppError)
+	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
@@ -49,16 +49,16 @@ func (mr *MockCommandMockRecorder) Handle(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Handle", reflect.TypeOf((*MockCommand)(nil).Handle), arg0)
 }
 
-// executeHelloCommand mocks base method.
-func (m *MockCommand) executeHelloCommand(arg0 *model.CommandArgs) *model.CommandResponse {
+// executeCollabviewCommand mocks base method.
+func (m *MockCommand) executeCollabviewCommand(arg0 *model.CommandArgs) *model.CommandResponse {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "executeHelloCommand", arg0)
+	ret := m.ctrl.Call(m, "executeCollabviewCommand", arg0)
 	ret0, _ := ret[0].(*model.CommandResponse)
 	return ret0
 }
 
-// executeHelloCommand indicates an expected call of executeHelloCommand.
-func (mr *MockCommandMockRecorder) executeHelloCommand(arg0 interface{}) *gomock.Call {
+// executeCollabviewCommand indicates an expected call of executeCollabviewCommand.
+func (mr *MockCommandMockRecorder) executeCollabviewCommand(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "executeHelloCommand", reflect.TypeOf((*MockCommand)(nil).executeHelloCommand), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "executeCollabviewCommand", reflect.TypeOf((*MockCommand)(nil).executeCollabviewCommand), arg0)
 }
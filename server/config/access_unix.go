@@ -0,0 +1,10 @@
+//go:build !windows
+
+package config
+
+import "golang.org/x/sys/unix"
+
+// checkWritable asks the kernel whether the plugin process may write to path, without writing.
+func checkWritable(path string) error {
+	return unix.Access(path, unix.W_OK)
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package config
+
+import (
+	"errors"
+	"os"
+)
+
+// checkWritable approximates write access from the read-only attribute, without writing.
+func checkWritable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0200 == 0 {
+		return errors.New("read-only")
+	}
+	return nil
+}
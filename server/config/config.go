@@ -3,10 +3,18 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"path"
 	"path/filepath"
-	"sync"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/mattermost/mattermost/server/public/plugin"
+
+	"github.com/jyoonje/collabview_plugin/server/fileconverter"
+	"github.com/jyoonje/collabview_plugin/server/store/artifactstore"
 )
 
 type Config struct {
@@ -14,59 +22,306 @@ type Config struct {
 	PythonPath         string `json:"PYTHON_PATH"`
 	MattermostDataRoot string `json:"MATTERMOST_DATA_ROOT"`
 	MattermostOutput   string `json:"MATTERMOST_OUTPUT_ROOT"`
+
+	// MaxConcurrency is the number of conversions allowed to run at the same time.
+	MaxConcurrency int `json:"CONVERT_MAX_CONCURRENCY"`
+	// QueueDepth is the number of conversions allowed to wait for a free worker.
+	QueueDepth int `json:"CONVERT_QUEUE_DEPTH"`
+	// MaxAttempts is the number of times a file, or an artifact cleanup, is tried before it is dead-lettered.
+	MaxAttempts int `json:"CONVERT_MAX_ATTEMPTS"`
+	// RetryBaseDelaySeconds is the backoff before the first retry; it doubles on every attempt.
+	RetryBaseDelaySeconds int `json:"CONVERT_RETRY_BASE_DELAY_SECONDS"`
+	// RetryMaxDelaySeconds caps the backoff between two attempts.
+	RetryMaxDelaySeconds int `json:"CONVERT_RETRY_MAX_DELAY_SECONDS"`
+	// TimeoutSeconds bounds a single file conversion; the converter is killed when it expires.
+	TimeoutSeconds int `json:"CONVERT_TIMEOUT_SECONDS"`
+
+	// GotenbergURL is the base URL of the Gotenberg instance used by the native converter.
+	// The converter is disabled when it is empty.
+	GotenbergURL string `json:"GOTENBERG_URL"`
+	// ConverterRoutes maps extensions and MIME types to converters, e.g. ".docx=gotenberg,image/*=passthrough,*=python".
+	ConverterRoutes string `json:"CONVERTER_ROUTES"`
+
+	// ViewerURL is the Collabview endpoint the webapp submits signed viewer requests to.
+	ViewerURL string `json:"COLLABVIEW_VIEWER_URL"`
+	// ViewerTokenSecret signs viewer tokens. When empty, a secret is generated and kept in the KV store.
+	ViewerTokenSecret string `json:"VIEWER_TOKEN_SECRET"`
+	// ViewerTokenTTLSeconds is how long a viewer token stays valid.
+	ViewerTokenTTLSeconds int `json:"VIEWER_TOKEN_TTL_SECONDS"`
+
+	// ArtifactStore selects where published artifacts are kept: "local" (Collabview's output
+	// directory), "filestore" (Mattermost's own file storage) or "s3".
+	ArtifactStore string `json:"ARTIFACT_STORE"`
+	// S3Endpoint is the base URL of the S3-compatible service used by the s3 store, e.g. http://minio:9000.
+	S3Endpoint        string `json:"S3_ENDPOINT"`
+	S3Bucket          string `json:"S3_BUCKET"`
+	S3Region          string `json:"S3_REGION"`
+	S3PathPrefix      string `json:"S3_PATH_PREFIX"`
+	S3AccessKeyID     string `json:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `json:"S3_SECRET_ACCESS_KEY"`
+
+	// ArtifactRetentionDays is how long published artifacts are kept. Zero keeps them forever.
+	ArtifactRetentionDays int `json:"ARTIFACT_RETENTION_DAYS"`
+	// JobRetentionDays is how long finished job records are kept before they are compacted.
+	JobRetentionDays int `json:"JOB_RETENTION_DAYS"`
+	// AuditRetentionDays is how long cleanup audit records are kept before they are pruned.
+	AuditRetentionDays int `json:"AUDIT_RETENTION_DAYS"`
+
+	// ReconcileChannelIDs is a comma separated list of the channels whose recent attachments are
+	// checked for missing or corrupt artifacts. Reconciliation is disabled when it is empty.
+	ReconcileChannelIDs string `json:"RECONCILE_CHANNEL_IDS"`
+	// ReconcileLookbackHours is how far back reconciliation looks for posts.
+	ReconcileLookbackHours int `json:"RECONCILE_LOOKBACK_HOURS"`
+
+	// BackfillFilesPerMinute throttles how fast a backfill enqueues conversions.
+	BackfillFilesPerMinute int `json:"BACKFILL_FILES_PER_MINUTE"`
+
+	// MaxInputFileSizeMB is the largest attachment read through the file API, which hands over
+	// the whole content at once.
+	MaxInputFileSizeMB int `json:"MAX_INPUT_FILE_SIZE_MB"`
 }
 
-var (
-	cfg        *Config
-	configOnce sync.Once
+const (
+	DefaultMaxConcurrency         = 2
+	DefaultQueueDepth             = 100
+	DefaultMaxAttempts            = 5
+	DefaultRetryBaseDelaySeconds  = 10
+	DefaultRetryMaxDelaySeconds   = 600
+	DefaultTimeoutSeconds         = 300
+	DefaultViewerTokenTTLSeconds  = 300
+	DefaultJobRetentionDays       = 7
+	DefaultAuditRetentionDays     = 90
+	DefaultReconcileLookbackHours = 24
+	DefaultBackfillFilesPerMinute = 30
+	DefaultMaxInputFileSizeMB     = 100
 )
 
-// Load reads and caches the plugin configuration from plugin_config.json.
-func Load(pluginAPI plugin.API) *Config {
-	configOnce.Do(func() {
-		bundlePath, err := pluginAPI.GetBundlePath()
-		if err != nil {
-			pluginAPI.LogError("Failed to get plugin bundle path", "error", err.Error())
-			return
-		}
+// RetryBaseDelay returns the configured base retry backoff.
+func (c *Config) RetryBaseDelay() time.Duration {
+	return time.Duration(c.RetryBaseDelaySeconds) * time.Second
+}
 
-		configPath := filepath.Join(bundlePath, "config", "plugin_config.json")
-		file, err := os.Open(configPath)
-		if err != nil {
-			pluginAPI.LogError("Failed to open plugin_config.json", "path", configPath, "error", err.Error())
-			return
-		}
-		defer file.Close()
+// RetryMaxDelay returns the configured retry backoff cap.
+func (c *Config) RetryMaxDelay() time.Duration {
+	return time.Duration(c.RetryMaxDelaySeconds) * time.Second
+}
+
+// Timeout returns the configured per-file conversion timeout.
+func (c *Config) Timeout() time.Duration {
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+// ViewerTokenTTL returns how long a viewer token stays valid.
+func (c *Config) ViewerTokenTTL() time.Duration {
+	return time.Duration(c.ViewerTokenTTLSeconds) * time.Second
+}
+
+// ViewerFilePath returns an artifact of the local store as the viewer addresses it, relative to
+// its web root. Artifacts of the other stores are served by the plugin instead.
+func (c *Config) ViewerFilePath(artifactKey string) string {
+	return path.Join("output", artifactKey)
+}
+
+// LocalArtifactRoot returns the Collabview directory the local store publishes artifacts to.
+func (c *Config) LocalArtifactRoot() string {
+	return filepath.Join(c.CollabviewRoot, "public", "web", "output")
+}
+
+// workDirName is the directory the plugin owns under MattermostOutput.
+const workDirName = ".collabview-work"
 
-		decoder := json.NewDecoder(file)
-		loaded := &Config{}
-		if err := decoder.Decode(loaded); err != nil {
-			pluginAPI.LogError("Failed to decode plugin_config.json", "error", err.Error())
-			return
+// WorkDir returns the plugin-owned directory under MattermostOutput where attachments are staged
+// and converted before they are published. The maintenance sweep purges what is left behind
+// there, and nowhere else.
+func (c *Config) WorkDir() string {
+	return filepath.Join(c.MattermostOutput, workDirName)
+}
+
+// WritableDirs returns the directories the plugin writes to, which are created when the
+// configuration is applied.
+func (c *Config) WritableDirs() []string {
+	dirs := []string{c.WorkDir()}
+	if c.ArtifactStore == artifactstore.LocalStoreName {
+		dirs = append(dirs, c.LocalArtifactRoot())
+	}
+	return dirs
+}
+
+// ArtifactRetention returns how long artifacts are kept, or zero when they never expire.
+func (c *Config) ArtifactRetention() time.Duration {
+	return time.Duration(c.ArtifactRetentionDays) * 24 * time.Hour
+}
+
+// JobRetention returns how long finished job records are kept.
+func (c *Config) JobRetention() time.Duration {
+	return time.Duration(c.JobRetentionDays) * 24 * time.Hour
+}
+
+// AuditRetention returns how long cleanup audit records are kept.
+func (c *Config) AuditRetention() time.Duration {
+	return time.Duration(c.AuditRetentionDays) * 24 * time.Hour
+}
+
+// ReconcileChannels returns the channels covered by reconciliation.
+func (c *Config) ReconcileChannels() []string {
+	var channelIDs []string
+	for _, channelID := range strings.Split(c.ReconcileChannelIDs, ",") {
+		if channelID = strings.TrimSpace(channelID); channelID != "" {
+			channelIDs = append(channelIDs, channelID)
 		}
+	}
+	return channelIDs
+}
+
+// ReconcileLookback returns how far back reconciliation looks for posts.
+func (c *Config) ReconcileLookback() time.Duration {
+	return time.Duration(c.ReconcileLookbackHours) * time.Hour
+}
+
+// BackfillInterval returns the pause a backfill takes after enqueueing a conversion.
+func (c *Config) BackfillInterval() time.Duration {
+	return time.Minute / time.Duration(c.BackfillFilesPerMinute)
+}
 
-		cfg = loaded
-		pluginAPI.LogInfo("Config loaded successfully", "config", *cfg)
-	})
-	return cfg
+// MaxInputFileSize returns the largest attachment, in bytes, read through the file API.
+func (c *Config) MaxInputFileSize() int64 {
+	return int64(c.MaxInputFileSizeMB) << 20
 }
 
-// GetConvertedFilePath returns the full path to the source .esob file.
-func GetConvertedFilePath(postID, filename string) string {
-	if cfg == nil {
-		return ""
+// applyDefaults fills in tuning values that were left unset.
+func (c *Config) applyDefaults() {
+	if c.MaxConcurrency <= 0 {
+		c.MaxConcurrency = DefaultMaxConcurrency
+	}
+	if c.QueueDepth <= 0 {
+		c.QueueDepth = DefaultQueueDepth
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = DefaultMaxAttempts
+	}
+	if c.RetryBaseDelaySeconds <= 0 {
+		c.RetryBaseDelaySeconds = DefaultRetryBaseDelaySeconds
+	}
+	if c.RetryMaxDelaySeconds <= 0 {
+		c.RetryMaxDelaySeconds = DefaultRetryMaxDelaySeconds
+	}
+	if c.ConverterRoutes == "" {
+		c.ConverterRoutes = fileconverter.DefaultRoutes
 	}
-	esobName := changeExtensionToEsob(filename)
-	return filepath.Join(cfg.MattermostOutput, postID, esobName)
+	if c.TimeoutSeconds <= 0 {
+		c.TimeoutSeconds = DefaultTimeoutSeconds
+	}
+	if c.ViewerTokenTTLSeconds <= 0 {
+		c.ViewerTokenTTLSeconds = DefaultViewerTokenTTLSeconds
+	}
+	if c.JobRetentionDays <= 0 {
+		c.JobRetentionDays = DefaultJobRetentionDays
+	}
+	if c.AuditRetentionDays <= 0 {
+		c.AuditRetentionDays = DefaultAuditRetentionDays
+	}
+	if c.ReconcileLookbackHours <= 0 {
+		c.ReconcileLookbackHours = DefaultReconcileLookbackHours
+	}
+	if c.BackfillFilesPerMinute <= 0 {
+		c.BackfillFilesPerMinute = DefaultBackfillFilesPerMinute
+	}
+	if c.MaxInputFileSizeMB <= 0 {
+		c.MaxInputFileSizeMB = DefaultMaxInputFileSizeMB
+	}
+	if c.ArtifactStore == "" {
+		c.ArtifactStore = artifactstore.DefaultStoreName
+	}
+}
+
+// Load builds the plugin configuration. Settings saved in the System Console take precedence,
+// even when they were saved empty; the saved setting names are listed in saved. Settings the
+// console never stored fall back to the optional plugin_config.json bundled with the plugin,
+// and tuning values still unset get the built-in defaults. The file is read again on every
+// call so that it can be edited without restarting the plugin.
+func Load(pluginAPI plugin.API, settings *Config, saved []string) *Config {
+	loaded := &Config{}
+	if settings != nil {
+		*loaded = *settings
+	}
+
+	if fallback := loadFile(pluginAPI); fallback != nil {
+		loaded.fillFrom(fallback, saved)
+	}
+	loaded.applyDefaults()
+
+	pluginAPI.LogInfo("Config loaded successfully", "config", loaded.redacted())
+	return loaded
 }
 
-// GetFinalOutputPath returns the full destination path for the .esob file.
-func GetFinalOutputPath(postID, filename string) string {
-	if cfg == nil {
-		return ""
+// loadFile reads plugin_config.json from the bundle. The file is optional; nil is returned
+// when it is missing or unreadable.
+func loadFile(pluginAPI plugin.API) *Config {
+	bundlePath, err := pluginAPI.GetBundlePath()
+	if err != nil {
+		pluginAPI.LogError("Failed to get plugin bundle path", "error", err.Error())
+		return nil
+	}
+
+	configPath := filepath.Join(bundlePath, "config", "plugin_config.json")
+	file, err := os.Open(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		pluginAPI.LogError("Failed to open plugin_config.json", "path", configPath, "error", err.Error())
+		return nil
 	}
-	esobName := changeExtensionToEsob(filename)
-	return filepath.Join(cfg.CollabviewRoot, "public", "web", "output", postID, esobName)
+	defer file.Close()
+
+	loaded := &Config{}
+	if err := json.NewDecoder(file).Decode(loaded); err != nil {
+		pluginAPI.LogError("Failed to decode plugin_config.json", "error", err.Error())
+		return nil
+	}
+	return loaded
+}
+
+// fillFrom copies every field of fallback that is still zero-valued in c, unless the setting
+// of that name was saved in the System Console. Mattermost lowercases the saved names.
+func (c *Config) fillFrom(fallback *Config, saved []string) {
+	target := reflect.ValueOf(c).Elem()
+	source := reflect.ValueOf(fallback).Elem()
+	for i := 0; i < target.NumField(); i++ {
+		name := target.Type().Field(i).Name
+		if slices.ContainsFunc(saved, func(s string) bool { return strings.EqualFold(s, name) }) {
+			continue
+		}
+		if target.Field(i).IsZero() {
+			target.Field(i).Set(source.Field(i))
+		}
+	}
+}
+
+// redacted returns a copy of the configuration that is safe to log.
+func (c *Config) redacted() Config {
+	clone := *c
+	if clone.ViewerTokenSecret != "" {
+		clone.ViewerTokenSecret = "********"
+	}
+	if clone.S3SecretAccessKey != "" {
+		clone.S3SecretAccessKey = "********"
+	}
+	return clone
+}
+
+// ConvertedFilePath returns where the converter writes the artifact of an attachment, with the
+// converter's output extension, before it is published.
+func (c *Config) ConvertedFilePath(fileID, filename, ext string) string {
+	return filepath.Join(c.WorkDir(), fileID, artifactName(filename, ext))
+}
+
+// ArtifactKey returns the key the artifact of an attachment is published under, ending with
+// the converter's output extension. Keys are grouped by post and made unique by the file ID, so
+// attachments sharing a name on one post never overwrite each other; the sanitized display
+// name is kept for the viewer.
+func ArtifactKey(postID, fileID, filename, ext string) string {
+	return path.Join(postID, fileID, artifactName(filename, ext))
 }
 
 // EnsureDir ensures that the given directory exists.
@@ -74,7 +329,49 @@ func EnsureDir(path string) error {
 	return os.MkdirAll(path, os.ModePerm)
 }
 
-// changeExtensionToEsob converts the given filename to .esob extension.
-func changeExtensionToEsob(filename string) string {
-	return filename[:len(filename)-len(filepath.Ext(filename))] + ".esob"
+// maxFileNameBytes keeps artifact names within the limits of common filesystems.
+const maxFileNameBytes = 200
+
+// InputFileName converts the attachment's name to a safe file name for the copy staged for its
+// conversion, keeping the extension the converter may depend on.
+func InputFileName(filename string) string {
+	return artifactName(filename, filepath.Ext(sanitizeFileName(filename)))
+}
+
+// artifactName converts the attachment's name to a safe file name with the given extension.
+func artifactName(filename, ext string) string {
+	name := sanitizeFileName(filename)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	for len(name) > maxFileNameBytes {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" {
+		name = "file"
+	}
+	return name + ext
+}
+
+// sanitizeFileName reduces a user-supplied file name to a single, portable path element:
+// directories are dropped, and separators, control and reserved characters are replaced.
+func sanitizeFileName(filename string) string {
+	filename = strings.ReplaceAll(filename, "\\", "/")
+	filename = filename[strings.LastIndex(filename, "/")+1:]
+
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, r == 0x7f, r == utf8.RuneError:
+			return '_'
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		}
+		return r
+	}, filename)
+
+	// Leading dots would hide the file or turn it into "." and "..".
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name == "" {
+		return "file"
+	}
+	return name
 }
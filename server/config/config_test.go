@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	bundlePath := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(bundlePath, "config"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(bundlePath, "config", "plugin_config.json"), []byte(`{
+		"COLLABVIEW_PUBLIC_ROOT": "/file/collabview",
+		"PYTHON_PATH": "/file/python",
+		"CONVERT_MAX_CONCURRENCY": 8,
+		"ARTIFACT_RETENTION_DAYS": 30
+	}`), 0600))
+
+	api := &plugintest.API{}
+	api.On("GetBundlePath").Return(bundlePath, nil)
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	loaded := Load(api, &Config{
+		CollabviewRoot: "/console/collabview",
+		QueueDepth:     7,
+	}, nil)
+
+	// System Console settings win over the file, which wins over the defaults.
+	assert.Equal(t, "/console/collabview", loaded.CollabviewRoot)
+	assert.Equal(t, "/file/python", loaded.PythonPath)
+	assert.Equal(t, 8, loaded.MaxConcurrency)
+	assert.Equal(t, 7, loaded.QueueDepth)
+	assert.Equal(t, DefaultMaxAttempts, loaded.MaxAttempts)
+	assert.Equal(t, 30, loaded.ArtifactRetentionDays)
+
+	// Settings saved in the System Console win even when they were saved empty.
+	cleared := Load(api, &Config{CollabviewRoot: "/console/collabview"}, []string{"pythonpath", "artifactretentiondays", "maxconcurrency"})
+	assert.Empty(t, cleared.PythonPath)
+	assert.Zero(t, cleared.ArtifactRetentionDays)
+	assert.Equal(t, DefaultMaxConcurrency, cleared.MaxConcurrency)
+
+	// Every call builds a fresh configuration.
+	reloaded := Load(api, &Config{CollabviewRoot: "/console/other"}, nil)
+	assert.Equal(t, "/console/other", reloaded.CollabviewRoot)
+	assert.Equal(t, "/console/collabview", loaded.CollabviewRoot)
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetBundlePath").Return(t.TempDir(), nil)
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	loaded := Load(api, &Config{CollabviewRoot: "/console/collabview"}, nil)
+
+	assert.Equal(t, "/console/collabview", loaded.CollabviewRoot)
+	assert.Equal(t, DefaultMaxConcurrency, loaded.MaxConcurrency)
+	assert.Equal(t, filepath.Join("/console/collabview", "public", "web", "output"), loaded.LocalArtifactRoot())
+	assert.Equal(t, "output/post/file/plan.esob", loaded.ViewerFilePath("post/file/plan.esob"))
+}
+
+func TestArtifactKey(t *testing.T) {
+	for _, tc := range []struct {
+		filename string
+		expected string
+	}{
+		{"plan.pdf", "post/file/plan.esob"},
+		{"도면 v2.dwg", "post/file/도면 v2.esob"},
+		{"../../etc/passwd", "post/file/passwd.esob"},
+		{`..\..\boot.ini`, "post/file/boot.esob"},
+		{"..", "post/file/file.esob"},
+		{".hidden.pdf", "post/file/hidden.esob"},
+		{"a<b>:c?.pdf", "post/file/a_b__c_.esob"},
+		{"line\nbreak.pdf", "post/file/line_break.esob"},
+		{"", "post/file/file.esob"},
+	} {
+		assert.Equal(t, tc.expected, ArtifactKey("post", "file", tc.filename, ".esob"), tc.filename)
+	}
+
+	// Same-named attachments of one post get distinct keys.
+	assert.NotEqual(t, ArtifactKey("post", "file1", "plan.pdf", ".esob"), ArtifactKey("post", "file2", "plan.docx", ".esob"))
+
+	long := ArtifactKey("post", "file", strings.Repeat("가", 100)+".pdf", ".esob")
+	assert.LessOrEqual(t, len(path.Base(long)), maxFileNameBytes+len(".esob"))
+	assert.True(t, utf8.ValidString(long))
+
+	// The key ends with the extension of what the converter produced.
+	assert.Equal(t, "post/file/plan.pdf", ArtifactKey("post", "file", "plan.docx", ".pdf"))
+	assert.Equal(t, "post/file/photo.png", ArtifactKey("post", "file", "photo.png", ".png"))
+}
+
+func TestInputFileName(t *testing.T) {
+	for _, tc := range []struct {
+		filename string
+		expected string
+	}{
+		{"plan.pdf", "plan.pdf"},
+		{"도면 v2.dwg", "도면 v2.dwg"},
+		{"../../etc/passwd", "passwd"},
+		{`..\..\boot.ini`, "boot.ini"},
+		{"..", "file"},
+		{".hidden.pdf", "hidden.pdf"},
+		{"a<b>:c?.pdf", "a_b__c_.pdf"},
+		{"", "file"},
+	} {
+		assert.Equal(t, tc.expected, InputFileName(tc.filename), tc.filename)
+	}
+
+	long := InputFileName(strings.Repeat("가", 100) + ".pdf")
+	assert.LessOrEqual(t, len(long), maxFileNameBytes+len(".pdf"))
+	assert.True(t, strings.HasSuffix(long, ".pdf"))
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+
+	"github.com/jyoonje/collabview_plugin/server/fileconverter"
+	"github.com/jyoonje/collabview_plugin/server/store/artifactstore"
+)
+
+// gotenbergCheckTimeout bounds the reachability check of Gotenberg, which runs synchronously on
+// every configuration change. An unreachable Gotenberg is only a warning.
+const gotenbergCheckTimeout = 2 * time.Second
+
+// Severity tells whether a problem prevents the plugin from working.
+type Severity string
+
+const (
+	// SeverityError problems make conversions fail; the configuration is rejected.
+	SeverityError Severity = "error"
+	// SeverityWarning problems may be transient or only affect part of the plugin.
+	SeverityWarning Severity = "warning"
+)
+
+// Problem is a single validation finding tied to the System Console setting to fix.
+type Problem struct {
+	Setting  string   `json:"setting"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Setting, p.Message)
+}
+
+// Problems is the outcome of Validate.
+type Problems []Problem
+
+// Errors returns only the problems that reject the configuration.
+func (ps Problems) Errors() Problems {
+	var errs Problems
+	for _, p := range ps {
+		if p.Severity == SeverityError {
+			errs = append(errs, p)
+		}
+	}
+	return errs
+}
+
+func (ps Problems) Error() string {
+	messages := make([]string, 0, len(ps))
+	for _, p := range ps {
+		messages = append(messages, p.String())
+	}
+	return "invalid plugin configuration: " + strings.Join(messages, "; ")
+}
+
+// Validate checks that every path the plugin relies on exists with the right permissions, that
+// the conversion pipeline is runnable and that Gotenberg answers. It has no side effects on the
+// filesystem, so it can back a read-only validation endpoint.
+func Validate(c *Config) Problems {
+	var problems Problems
+	addError := func(setting, format string, args ...any) {
+		problems = append(problems, Problem{Setting: setting, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+	}
+	addWarning := func(setting, format string, args ...any) {
+		problems = append(problems, Problem{Setting: setting, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)})
+	}
+
+	routes, err := fileconverter.ParseRoutes(c.ConverterRoutes)
+	if err != nil {
+		addError("ConverterRoutes", "%s", err)
+	}
+	usesConverter := func(name string) bool {
+		for _, converter := range routes {
+			if converter == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	if err := checkDir(c.CollabviewRoot, false); err != nil {
+		addError("CollabviewRoot", "%s", err)
+	} else if c.ArtifactStore == artifactstore.LocalStoreName {
+		if err := checkDir(c.LocalArtifactRoot(), true); err != nil {
+			addError("CollabviewRoot", "artifacts cannot be published: %s", err)
+		}
+	}
+
+	switch c.ArtifactStore {
+	case artifactstore.LocalStoreName, artifactstore.FileStoreName:
+	case artifactstore.S3StoreName:
+		for _, required := range []struct{ setting, value string }{
+			{"S3Endpoint", c.S3Endpoint},
+			{"S3Bucket", c.S3Bucket},
+			{"S3AccessKeyID", c.S3AccessKeyID},
+			{"S3SecretAccessKey", c.S3SecretAccessKey},
+		} {
+			if required.value == "" {
+				addError(required.setting, "required by the s3 artifact store")
+			}
+		}
+	default:
+		addError("ArtifactStore", "unknown artifact store %q", c.ArtifactStore)
+	}
+
+	// Without a data directory attachments are read through the file API.
+	if c.MattermostDataRoot != "" {
+		if err := checkDir(c.MattermostDataRoot, false); err != nil {
+			addError("MattermostDataRoot", "%s", err)
+		}
+	}
+
+	if err := checkDir(c.MattermostOutput, true); err != nil {
+		addError("MattermostOutput", "%s", err)
+	} else {
+		// Leftovers of the working directory are purged, so it must not share files with the
+		// directories the plugin reads from or publishes to. The Collabview root covers the
+		// local artifact root below it.
+		for _, other := range []struct{ setting, path string }{
+			{"MattermostDataRoot", c.MattermostDataRoot},
+			{"CollabviewRoot", c.CollabviewRoot},
+		} {
+			if other.path != "" && pathsOverlap(c.MattermostOutput, other.path) {
+				addError("MattermostOutput", "must not overlap %s (%s)", other.setting, other.path)
+				break
+			}
+		}
+	}
+
+	if usesConverter(fileconverter.PythonConverterName) {
+		if err := checkExecutable(c.PythonPath); err != nil {
+			addError("PythonPath", "%s", err)
+		}
+		if c.CollabviewRoot != "" {
+			script := filepath.Join(c.CollabviewRoot, "public", "web", "convert.py")
+			if err := checkReadableFile(script); err != nil {
+				addError("CollabviewRoot", "convert.py: %s", err)
+			}
+		}
+	}
+
+	if c.GotenbergURL == "" {
+		if usesConverter(fileconverter.GotenbergConverterName) {
+			addError("GotenbergURL", "required by the gotenberg converter routes")
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), gotenbergCheckTimeout)
+		defer cancel()
+		if err := fileconverter.NewGotenbergConverter(c.GotenbergURL, nil).Ping(ctx); err != nil {
+			addWarning("GotenbergURL", "Gotenberg is not reachable: %s", err)
+		}
+	}
+
+	if c.ViewerURL == "" {
+		addWarning("ViewerURL", "not set, converted files cannot be opened in Collabview")
+	}
+
+	for _, channelID := range c.ReconcileChannels() {
+		if !model.IsValidId(channelID) {
+			addError("ReconcileChannelIDs", "%q is not a valid channel ID", channelID)
+		}
+	}
+
+	if c.ArtifactRetentionDays < 0 {
+		addError("ArtifactRetentionDays", "must not be negative")
+	}
+
+	if c.RetryMaxDelaySeconds < c.RetryBaseDelaySeconds {
+		addError("RetryMaxDelaySeconds", "must not be lower than RetryBaseDelaySeconds (%d)", c.RetryBaseDelaySeconds)
+	}
+
+	return problems
+}
+
+// checkDir verifies that path is a readable directory, and writable when requested. A missing
+// writable directory is accepted when its closest existing parent is writable, since it is
+// created when the configuration is applied. Nothing is created or written here.
+func checkDir(path string, writable bool) error {
+	if path == "" {
+		return fmt.Errorf("not set")
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && writable {
+		parent := filepath.Dir(filepath.Clean(path))
+		for {
+			if _, err := os.Stat(parent); err == nil || filepath.Dir(parent) == parent {
+				break
+			}
+			parent = filepath.Dir(parent)
+		}
+		if err := checkWritable(parent); err != nil {
+			return fmt.Errorf("%s does not exist and cannot be created in %s: %w", path, parent, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s is not accessible: %w", path, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+
+	entries, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s is not readable: %w", path, err)
+	}
+	entries.Close()
+
+	if writable {
+		if err := checkWritable(path); err != nil {
+			return fmt.Errorf("%s is not writable: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// pathsOverlap reports whether one of the directories is, or contains, the other. Symbolic
+// links are resolved where the paths exist.
+func pathsOverlap(a, b string) bool {
+	a, b = resolvePath(a), resolvePath(b)
+	return isWithin(a, b) || isWithin(b, a)
+}
+
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func resolvePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+func checkReadableFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s is not accessible: %w", path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s is not readable: %w", path, err)
+	}
+	return file.Close()
+}
+
+func checkExecutable(path string) error {
+	if path == "" {
+		return fmt.Errorf("not set")
+	}
+	if err := checkReadableFile(path); err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validLayout creates a Collabview root with convert.py, a Python executable and the
+// Mattermost directories, returning a configuration that passes validation.
+func validLayout(t *testing.T) *Config {
+	root := t.TempDir()
+	collabview := filepath.Join(root, "collabview")
+	require.NoError(t, os.MkdirAll(filepath.Join(collabview, "public", "web"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(collabview, "public", "web", "convert.py"), []byte("print()"), 0600))
+	python := filepath.Join(root, "python")
+	require.NoError(t, os.WriteFile(python, []byte("#!/bin/sh"), 0700))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "data"), 0700))
+
+	c := &Config{
+		CollabviewRoot:     collabview,
+		PythonPath:         python,
+		MattermostDataRoot: filepath.Join(root, "data"),
+		MattermostOutput:   filepath.Join(root, "output"),
+		ViewerURL:          "http://collabview.example.com/cv_call",
+	}
+	c.applyDefaults()
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		mutate   func(t *testing.T, c *Config)
+		expected []string
+	}{
+		{
+			name:   "valid",
+			mutate: func(t *testing.T, c *Config) {},
+		},
+		{
+			name: "missing paths",
+			mutate: func(t *testing.T, c *Config) {
+				c.CollabviewRoot = ""
+				c.MattermostDataRoot = filepath.Join(t.TempDir(), "missing")
+			},
+			expected: []string{"CollabviewRoot", "MattermostDataRoot"},
+		},
+		{
+			name: "data directory is optional",
+			mutate: func(t *testing.T, c *Config) {
+				c.MattermostDataRoot = ""
+			},
+		},
+		{
+			name: "s3 store settings",
+			mutate: func(t *testing.T, c *Config) {
+				c.ArtifactStore = "s3"
+				c.S3Endpoint = "http://minio:9000"
+			},
+			expected: []string{"S3Bucket", "S3AccessKeyID", "S3SecretAccessKey"},
+		},
+		{
+			name: "unknown artifact store",
+			mutate: func(t *testing.T, c *Config) {
+				c.ArtifactStore = "ftp"
+			},
+			expected: []string{"ArtifactStore"},
+		},
+		{
+			name: "missing convert.py",
+			mutate: func(t *testing.T, c *Config) {
+				require.NoError(t, os.Remove(filepath.Join(c.CollabviewRoot, "public", "web", "convert.py")))
+			},
+			expected: []string{"CollabviewRoot"},
+		},
+		{
+			name: "python is not executable",
+			mutate: func(t *testing.T, c *Config) {
+				if runtime.GOOS == "windows" {
+					t.Skip("executable bits are not checked on Windows")
+				}
+				require.NoError(t, os.Chmod(c.PythonPath, 0600))
+			},
+			expected: []string{"PythonPath"},
+		},
+		{
+			name: "python not needed without python routes",
+			mutate: func(t *testing.T, c *Config) {
+				c.PythonPath = ""
+				c.ConverterRoutes = "*=noop"
+			},
+		},
+		{
+			name: "gotenberg routes without URL",
+			mutate: func(t *testing.T, c *Config) {
+				c.ConverterRoutes = ".docx=gotenberg,*=python"
+			},
+			expected: []string{"GotenbergURL"},
+		},
+		{
+			name: "inverted retry delays",
+			mutate: func(t *testing.T, c *Config) {
+				c.RetryBaseDelaySeconds = 60
+				c.RetryMaxDelaySeconds = 10
+			},
+			expected: []string{"RetryMaxDelaySeconds"},
+		},
+		{
+			name: "negative artifact retention",
+			mutate: func(t *testing.T, c *Config) {
+				c.ArtifactRetentionDays = -1
+			},
+			expected: []string{"ArtifactRetentionDays"},
+		},
+		{
+			name: "viewer URL not set",
+			mutate: func(t *testing.T, c *Config) {
+				c.ViewerURL = ""
+			},
+			expected: []string{"ViewerURL"},
+		},
+		{
+			name: "output directory inside the artifact root",
+			mutate: func(t *testing.T, c *Config) {
+				c.MattermostOutput = filepath.Join(c.LocalArtifactRoot(), "work")
+			},
+			expected: []string{"MattermostOutput"},
+		},
+		{
+			name: "output directory containing the data directory",
+			mutate: func(t *testing.T, c *Config) {
+				c.MattermostOutput = filepath.Dir(c.MattermostDataRoot)
+			},
+			expected: []string{"MattermostOutput"},
+		},
+		{
+			name: "output directory is the data directory",
+			mutate: func(t *testing.T, c *Config) {
+				c.MattermostOutput = c.MattermostDataRoot + string(filepath.Separator)
+			},
+			expected: []string{"MattermostOutput"},
+		},
+		{
+			name: "output directory next to a similarly named one",
+			mutate: func(t *testing.T, c *Config) {
+				c.MattermostOutput = c.MattermostDataRoot + "-output"
+			},
+		},
+		{
+			name: "invalid reconciliation channel",
+			mutate: func(t *testing.T, c *Config) {
+				c.ReconcileChannelIDs = "pcw3brwjdbn5bpsk4f1u1ez3bw, town-square"
+			},
+			expected: []string{"ReconcileChannelIDs"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := validLayout(t)
+			tc.mutate(t, c)
+
+			var settings []string
+			for _, problem := range Validate(c) {
+				settings = append(settings, problem.Setting)
+			}
+			assert.ElementsMatch(t, tc.expected, settings)
+		})
+	}
+}
+
+func TestValidateGotenbergReachability(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+	}))
+	defer healthy.Close()
+
+	c := validLayout(t)
+	c.GotenbergURL = healthy.URL
+	assert.Empty(t, Validate(c))
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	down.Close()
+
+	c.GotenbergURL = down.URL
+	problems := Validate(c)
+	require.Len(t, problems, 1)
+	assert.Equal(t, SeverityWarning, problems[0].Severity)
+	assert.Empty(t, problems.Errors())
+}
+
+func TestValidateIsReadOnly(t *testing.T) {
+	c := validLayout(t)
+	require.NoError(t, os.MkdirAll(c.LocalArtifactRoot(), 0700))
+
+	require.Empty(t, Validate(c).Errors())
+	assert.NoDirExists(t, c.MattermostOutput, "missing directories are created when the configuration is applied")
+	entries, err := os.ReadDir(c.LocalArtifactRoot())
+	require.NoError(t, err)
+	assert.Empty(t, entries, "no write probe is left behind")
+
+	c.MattermostOutput = filepath.Join(c.PythonPath, "output")
+	problems := Validate(c)
+	require.Len(t, problems, 1, "a directory cannot be created under a file")
+	assert.Equal(t, "MattermostOutput", problems[0].Setting)
+}
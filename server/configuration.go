@@ -5,6 +5,10 @@ import (
 
 	"github.com/mattermost/mattermost/server/public/pluginapi"
 	"github.com/pkg/errors"
+
+	"github.com/jyoonje/collabview_plugin/server/config"
+	"github.com/jyoonje/collabview_plugin/server/fileconverter"
+	"github.com/jyoonje/collabview_plugin/server/store/artifactstore"
 )
 
 // configuration captures the plugin's external configuration as exposed in the Mattermost server
@@ -19,6 +23,79 @@ import (
 // If you add non-reference types to your configuration struct, be sure to rewrite Clone as a deep
 // copy appropriate for your types.
 type configuration struct {
+	CollabviewRoot     string
+	PythonPath         string
+	MattermostDataRoot string
+	MattermostOutput   string
+
+	MaxConcurrency        int
+	QueueDepth            int
+	MaxAttempts           int
+	RetryBaseDelaySeconds int
+	RetryMaxDelaySeconds  int
+	TimeoutSeconds        int
+
+	GotenbergURL    string
+	ConverterRoutes string
+
+	ViewerURL             string
+	ViewerTokenSecret     string
+	ViewerTokenTTLSeconds int
+
+	ArtifactStore     string
+	S3Endpoint        string
+	S3Bucket          string
+	S3Region          string
+	S3PathPrefix      string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+
+	ArtifactRetentionDays int
+	JobRetentionDays      int
+	AuditRetentionDays    int
+
+	ReconcileChannelIDs    string
+	ReconcileLookbackHours int
+
+	BackfillFilesPerMinute int
+
+	MaxInputFileSizeMB int
+}
+
+// toConfig converts the System Console settings into the runtime configuration. Settings the
+// console never saved are filled from plugin_config.json or the built-in defaults by config.Load.
+func (c *configuration) toConfig() *config.Config {
+	return &config.Config{
+		CollabviewRoot:         c.CollabviewRoot,
+		PythonPath:             c.PythonPath,
+		MattermostDataRoot:     c.MattermostDataRoot,
+		MattermostOutput:       c.MattermostOutput,
+		MaxConcurrency:         c.MaxConcurrency,
+		QueueDepth:             c.QueueDepth,
+		MaxAttempts:            c.MaxAttempts,
+		RetryBaseDelaySeconds:  c.RetryBaseDelaySeconds,
+		RetryMaxDelaySeconds:   c.RetryMaxDelaySeconds,
+		TimeoutSeconds:         c.TimeoutSeconds,
+		GotenbergURL:           c.GotenbergURL,
+		ConverterRoutes:        c.ConverterRoutes,
+		ViewerURL:              c.ViewerURL,
+		ViewerTokenSecret:      c.ViewerTokenSecret,
+		ViewerTokenTTLSeconds:  c.ViewerTokenTTLSeconds,
+		ArtifactStore:          c.ArtifactStore,
+		S3Endpoint:             c.S3Endpoint,
+		S3Bucket:               c.S3Bucket,
+		S3Region:               c.S3Region,
+		S3PathPrefix:           c.S3PathPrefix,
+		S3AccessKeyID:          c.S3AccessKeyID,
+		S3SecretAccessKey:      c.S3SecretAccessKey,
+		ArtifactRetentionDays:  c.ArtifactRetentionDays,
+		JobRetentionDays:       c.JobRetentionDays,
+		AuditRetentionDays:     c.AuditRetentionDays,
+		ReconcileChannelIDs:    c.ReconcileChannelIDs,
+		ReconcileLookbackHours: c.ReconcileLookbackHours,
+		BackfillFilesPerMinute: c.BackfillFilesPerMinute,
+		MaxInputFileSizeMB:     c.MaxInputFileSizeMB,
+	}
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -69,6 +146,80 @@ func (p *Plugin) setConfiguration(configuration *configuration) {
 	p.configuration = configuration
 }
 
+// activeConfig is the runtime configuration together with the converters and the artifact store
+// built from it. It is swapped as a whole on every configuration change, so a job that took a
+// snapshot keeps a consistent view until it finishes.
+type activeConfig struct {
+	*config.Config
+	converters *fileconverter.Registry
+	artifacts  artifactstore.ArtifactStore
+}
+
+// snapshot returns the configuration currently in use, or nil while the plugin is inactive.
+func (p *Plugin) snapshot() *activeConfig {
+	return p.active.Load()
+}
+
+// savedSettings returns the names of the settings stored for the plugin in the server
+// configuration. Once an admin saves the System Console page, every setting is stored, the
+// empty ones included.
+func (p *Plugin) savedSettings() []string {
+	var names []string
+	for name := range p.API.GetPluginConfig() {
+		names = append(names, name)
+	}
+	return names
+}
+
+// applyConfiguration validates the System Console settings and swaps the resulting runtime
+// configuration in. Warnings are logged; on errors the previous configuration stays active.
+func (p *Plugin) applyConfiguration(settings *configuration) error {
+	cfg := config.Load(p.API, settings.toConfig(), p.savedSettings())
+
+	problems := config.Validate(cfg)
+	for _, problem := range problems {
+		if problem.Severity == config.SeverityWarning {
+			p.API.LogWarn("플러그인 설정 경고", "setting", problem.Setting, "problem", problem.Message)
+		} else {
+			p.API.LogError("플러그인 설정 오류", "setting", problem.Setting, "problem", problem.Message)
+		}
+	}
+	if errs := problems.Errors(); len(errs) > 0 {
+		return errs
+	}
+
+	for _, dir := range cfg.WritableDirs() {
+		if err := config.EnsureDir(dir); err != nil {
+			return errors.Wrapf(err, "failed to create %s", dir)
+		}
+	}
+
+	converters, err := newConverterRegistry(cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to configure converters")
+	}
+
+	artifacts, err := p.newArtifactStore(cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to configure the artifact store")
+	}
+
+	previous := p.active.Swap(&activeConfig{Config: cfg, converters: converters, artifacts: artifacts})
+	pool := p.pool.Load()
+	if previous == nil || pool == nil {
+		return nil
+	}
+
+	if previous.MaxConcurrency != cfg.MaxConcurrency {
+		pool.resize(cfg.MaxConcurrency)
+		p.API.LogInfo("변환 작업 풀 크기 변경", "workers", cfg.MaxConcurrency)
+	}
+	if previous.QueueDepth != cfg.QueueDepth {
+		p.API.LogWarn("변환 대기열 크기 변경은 플러그인을 다시 시작해야 적용됩니다", "queueDepth", cfg.QueueDepth)
+	}
+	return nil
+}
+
 // OnConfigurationChange is invoked when configuration changes may have been made.
 func (p *Plugin) OnConfigurationChange() error {
 	if p.client == nil {
@@ -83,5 +234,9 @@ func (p *Plugin) OnConfigurationChange() error {
 
 	p.setConfiguration(configuration)
 
-	return nil
+	// Before activation there is nothing to update; OnActivate applies the configuration.
+	if p.snapshot() == nil {
+		return nil
+	}
+	return p.applyConfiguration(configuration)
 }
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/jyoonje/collabview_plugin/server/config"
+	"github.com/jyoonje/collabview_plugin/server/fileconverter"
+)
+
+// newConverterRegistry registers every available conversion backend and applies the
+// configured routing rules.
+func newConverterRegistry(cfg *config.Config) (*fileconverter.Registry, error) {
+	converters := []fileconverter.Converter{
+		fileconverter.NewPythonConverter(fileconverter.PythonOptions{
+			PythonPath:     cfg.PythonPath,
+			CollabviewRoot: cfg.CollabviewRoot,
+			DataRoot:       cfg.MattermostDataRoot,
+			OutputRoot:     cfg.MattermostOutput,
+		}),
+		fileconverter.PassthroughConverter{},
+		fileconverter.NoopConverter{},
+	}
+	if cfg.GotenbergURL != "" {
+		converters = append(converters, fileconverter.NewGotenbergConverter(cfg.GotenbergURL, nil))
+	}
+
+	return fileconverter.NewRegistry(cfg.ConverterRoutes, converters...)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost/server/public/model"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+// WebSocket events published on every conversion transition. The server prefixes them with
+// "custom_<plugin id>_" before they reach the webapp.
+const (
+	wsEventConversionQueued   = "conversion_queued"
+	wsEventConversionStarted  = "conversion_started"
+	wsEventConversionProgress = "conversion_progress"
+	wsEventConversionDone     = "conversion_done"
+	wsEventConversionFailed   = "conversion_failed"
+)
+
+// Progress stages reported through wsEventConversionProgress.
+const (
+	progressStageConverting = "converting"
+	progressStagePublishing = "publishing"
+)
+
+var conversionStateEvents = map[kvstore.ConversionState]string{
+	kvstore.ConversionStateQueued:    wsEventConversionQueued,
+	kvstore.ConversionStateRunning:   wsEventConversionStarted,
+	kvstore.ConversionStateSucceeded: wsEventConversionDone,
+	kvstore.ConversionStateFailed:    wsEventConversionFailed,
+}
+
+// publishConversionStatus broadcasts a status change to the members of the post's channel.
+func (p *Plugin) publishConversionStatus(status *kvstore.ConversionStatus) {
+	event, ok := conversionStateEvents[status.State]
+	if !ok {
+		return
+	}
+
+	payload := map[string]any{
+		"file_id":    status.FileID,
+		"post_id":    status.PostID,
+		"state":      string(status.State),
+		"updated_at": status.UpdatedAt,
+	}
+	if status.Error != "" {
+		payload["error"] = status.Error
+	}
+	if status.DurationMs > 0 {
+		payload["duration_ms"] = status.DurationMs
+	}
+	p.publishConversionEvent(event, status.PostID, status.ChannelID, payload)
+}
+
+// publishConversionProgress tells the channel which stage the job's conversion reached.
+func (p *Plugin) publishConversionProgress(job *kvstore.Job, stage string) {
+	p.publishConversionEvent(wsEventConversionProgress, job.PostID, job.ChannelID, map[string]any{
+		"file_id": job.FileID,
+		"post_id": job.PostID,
+		"stage":   stage,
+	})
+}
+
+func (p *Plugin) publishConversionEvent(event, postID, channelID string, payload map[string]any) {
+	if channelID == "" {
+		// Jobs persisted before the channel was recorded; resolve it from the post.
+		post, appErr := p.API.GetPost(postID)
+		if appErr != nil {
+			p.API.LogWarn("변환 이벤트 채널 조회 실패", "postID", postID, "error", appErr.Error())
+			return
+		}
+		channelID = post.ChannelId
+	}
+
+	p.API.PublishWebSocketEvent(event, payload, &model.WebsocketBroadcast{ChannelId: channelID})
+}
@@ -0,0 +1,75 @@
+package fileconverter
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	PythonConverterName      = "python"
+	PassthroughConverterName = "passthrough"
+	NoopConverterName        = "noop"
+
+	// builtinConverterVersion is bumped when a built-in converter changes its output.
+	builtinConverterVersion = "1"
+)
+
+// PassthroughConverter publishes images unchanged; the viewer displays them natively.
+type PassthroughConverter struct{}
+
+func (PassthroughConverter) Name() string { return PassthroughConverterName }
+
+func (PassthroughConverter) Version() string { return builtinConverterVersion }
+
+func (PassthroughConverter) Supports(ext, mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
+
+// OutputExtension keeps the image's own extension, since its content is published as is.
+func (PassthroughConverter) OutputExtension(ext string) string { return ext }
+
+func (PassthroughConverter) Convert(ctx context.Context, inputPath, outputPath string) (err error) {
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err = os.MkdirAll(filepath.Dir(outputPath), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(outputPath)
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// NoopConverter accepts every file and produces nothing, for types that should not be converted.
+type NoopConverter struct{}
+
+func (NoopConverter) Name() string { return NoopConverterName }
+
+// Version is empty: there is no artifact to cache.
+func (NoopConverter) Version() string { return "" }
+
+func (NoopConverter) Supports(ext, mimeType string) bool { return true }
+
+func (NoopConverter) OutputExtension(ext string) string { return "" }
+
+func (NoopConverter) Convert(ctx context.Context, inputPath, outputPath string) error {
+	return ErrSkipped
+}
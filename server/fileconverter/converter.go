@@ -0,0 +1,126 @@
+package fileconverter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrSkipped is returned by converters that deliberately produce no artifact for a file.
+var ErrSkipped = errors.New("conversion skipped")
+
+// ErrNoConverter is returned when no routing rule matches a file.
+var ErrNoConverter = errors.New("no converter configured for file")
+
+// DefaultRoutes sends every file through the Python pipeline, matching the original behavior.
+const DefaultRoutes = "*=" + PythonConverterName
+
+// Converter turns an attachment into a Collabview artifact.
+type Converter interface {
+	// Name identifies the converter in routing rules.
+	Name() string
+	// Version changes whenever the converter may produce a different artifact from the same
+	// input, invalidating cached conversions. An empty version disables caching.
+	Version() string
+	// Supports reports whether the converter can handle files with the given lower-case
+	// extension (including the dot) and MIME type.
+	Supports(ext, mimeType string) bool
+	// OutputExtension returns the extension, including the dot, of the artifact converted from
+	// a file with the given lower-case extension. Collabview picks its renderer from it.
+	OutputExtension(ext string) string
+	// Convert reads inputPath and writes the artifact to outputPath.
+	Convert(ctx context.Context, inputPath, outputPath string) error
+}
+
+// Registry routes each file to a converter using extension and MIME type rules.
+type Registry struct {
+	converters map[string]Converter
+	routes     map[string]string
+}
+
+// NewRegistry builds a registry over the given converters and routing rules, see ParseRoutes.
+// It fails when a rule refers to a converter that was not provided.
+func NewRegistry(routes string, converters ...Converter) (*Registry, error) {
+	r := &Registry{
+		converters: make(map[string]Converter, len(converters)),
+	}
+	for _, c := range converters {
+		r.converters[c.Name()] = c
+	}
+
+	parsed, err := ParseRoutes(routes)
+	if err != nil {
+		return nil, err
+	}
+	for pattern, name := range parsed {
+		if _, ok := r.converters[name]; !ok {
+			return nil, fmt.Errorf("routing rule %q refers to unknown converter %q", pattern, name)
+		}
+	}
+	r.routes = parsed
+
+	return r, nil
+}
+
+// ParseRoutes parses comma separated "pattern=converter" rules. A pattern is an extension
+// (".dwg"), a MIME type ("application/pdf"), a MIME wildcard ("image/*") or "*" for every
+// other file.
+func ParseRoutes(spec string) (map[string]string, error) {
+	routes := make(map[string]string)
+	for _, rule := range strings.Split(spec, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		pattern, name, ok := strings.Cut(rule, "=")
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		name = strings.TrimSpace(name)
+		if !ok || pattern == "" || name == "" {
+			return nil, fmt.Errorf("invalid routing rule %q, expected pattern=converter", rule)
+		}
+		routes[pattern] = name
+	}
+	return routes, nil
+}
+
+// Route picks the converter for a file. The most specific rule wins: extension, exact MIME
+// type, MIME wildcard, then "*". A routed converter that does not support the file is skipped
+// in favor of the next rule.
+func (r *Registry) Route(filename, mimeType string) (Converter, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	mimeType = strings.ToLower(mimeType)
+
+	candidates := []string{ext, mimeType}
+	if major, _, ok := strings.Cut(mimeType, "/"); ok {
+		candidates = append(candidates, major+"/*")
+	}
+	candidates = append(candidates, "*")
+
+	for _, pattern := range candidates {
+		if pattern == "" {
+			continue
+		}
+		name, ok := r.routes[pattern]
+		if !ok {
+			continue
+		}
+		if c := r.converters[name]; c.Supports(ext, mimeType) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s (%s)", ErrNoConverter, filename, mimeType)
+}
+
+// Names lists the registered converters.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.converters))
+	for name := range r.converters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
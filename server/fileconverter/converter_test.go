@@ -0,0 +1,62 @@
+package fileconverter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryRoute(t *testing.T) {
+	registry, err := NewRegistry(
+		".dwg=noop, image/*=passthrough, .docx=gotenberg, text/html=gotenberg, *=python",
+		NewPythonConverter(PythonOptions{}),
+		NewGotenbergConverter("http://gotenberg:3000", nil),
+		PassthroughConverter{},
+		NoopConverter{},
+	)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		filename string
+		mimeType string
+		expected string
+	}{
+		{filename: "site.DWG", mimeType: "application/acad", expected: NoopConverterName},
+		{filename: "photo.png", mimeType: "image/png", expected: PassthroughConverterName},
+		{filename: "plan.docx", mimeType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", expected: GotenbergConverterName},
+		{filename: "page.html", mimeType: "text/html", expected: GotenbergConverterName},
+		{filename: "drawing.pdf", mimeType: "application/pdf", expected: PythonConverterName},
+		// The MIME rule routes to gotenberg, which does not support .xyz, so "*" applies.
+		{filename: "notes.xyz", mimeType: "text/html", expected: PythonConverterName},
+	} {
+		t.Run(tc.filename, func(t *testing.T) {
+			converter, err := registry.Route(tc.filename, tc.mimeType)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, converter.Name())
+		})
+	}
+}
+
+func TestRegistryWithoutFallback(t *testing.T) {
+	registry, err := NewRegistry("image/*=passthrough", PassthroughConverter{})
+	require.NoError(t, err)
+
+	_, err = registry.Route("plan.pdf", "application/pdf")
+	assert.ErrorIs(t, err, ErrNoConverter)
+}
+
+func TestNewRegistryErrors(t *testing.T) {
+	_, err := NewRegistry("*=gotenberg", NoopConverter{})
+	assert.ErrorContains(t, err, `unknown converter "gotenberg"`)
+
+	_, err = NewRegistry(".pdf", NoopConverter{})
+	assert.ErrorContains(t, err, "invalid routing rule")
+}
+
+func TestOutputExtension(t *testing.T) {
+	assert.Equal(t, ".esob", NewPythonConverter(PythonOptions{}).OutputExtension(".dwg"))
+	assert.Equal(t, ".pdf", NewGotenbergConverter("http://gotenberg", nil).OutputExtension(".docx"))
+	assert.Equal(t, ".png", PassthroughConverter{}.OutputExtension(".png"), "images keep their own format")
+	assert.Empty(t, NoopConverter{}.OutputExtension(".zip"))
+}
@@ -0,0 +1,193 @@
+package fileconverter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	GotenbergConverterName = "gotenberg"
+
+	gotenbergLibreOfficeRoute = "/forms/libreoffice/convert"
+	gotenbergChromiumRoute    = "/forms/chromium/convert/html"
+	gotenbergHealthRoute      = "/health"
+
+	// gotenbergErrorBodyLimit caps how much of an error response is kept in the error message.
+	gotenbergErrorBodyLimit = 4 << 10
+)
+
+// chromiumExtensions are rendered through Gotenberg's Chromium route; everything else goes
+// through LibreOffice.
+var chromiumExtensions = map[string]bool{
+	".html": true,
+	".htm":  true,
+}
+
+// libreOfficeExtensions are the document formats LibreOffice imports.
+var libreOfficeExtensions = map[string]bool{
+	".doc": true, ".docx": true, ".odt": true, ".rtf": true, ".txt": true,
+	".xls": true, ".xlsx": true, ".ods": true, ".csv": true,
+	".ppt": true, ".pptx": true, ".odp": true,
+	".odg": true, ".vsd": true, ".vsdx": true,
+}
+
+// GotenbergError is returned when Gotenberg answers with a non-2xx status.
+type GotenbergError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *GotenbergError) Error() string {
+	return fmt.Sprintf("gotenberg 응답 오류 (%d): %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether retrying the same request may succeed.
+func (e *GotenbergError) Temporary() bool {
+	return e.StatusCode >= http.StatusInternalServerError ||
+		e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout
+}
+
+// GotenbergConverter renders documents to PDF through Gotenberg's HTTP API, without the
+// Python pipeline.
+type GotenbergConverter struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewGotenbergConverter returns a converter talking to the Gotenberg instance at baseURL.
+// A nil client uses http.DefaultClient; timeouts are expected to come from the request context.
+func NewGotenbergConverter(baseURL string, client *http.Client) *GotenbergConverter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &GotenbergConverter{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  client,
+	}
+}
+
+func (g *GotenbergConverter) Name() string {
+	return GotenbergConverterName
+}
+
+func (g *GotenbergConverter) Version() string {
+	return builtinConverterVersion
+}
+
+func (g *GotenbergConverter) Supports(ext, mimeType string) bool {
+	return chromiumExtensions[ext] || libreOfficeExtensions[ext]
+}
+
+func (g *GotenbergConverter) OutputExtension(ext string) string {
+	return ".pdf"
+}
+
+// Ping checks that Gotenberg is up through its health route.
+func (g *GotenbergConverter) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.baseURL+gotenbergHealthRoute, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, gotenbergErrorBodyLimit))
+		return &GotenbergError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return nil
+}
+
+// Convert renders the file at inputPath and writes the resulting PDF to outputPath.
+// A partially written output is removed on failure.
+func (g *GotenbergConverter) Convert(ctx context.Context, inputPath, outputPath string) (err error) {
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err = os.MkdirAll(filepath.Dir(outputPath), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(outputPath)
+		}
+	}()
+
+	if chromiumExtensions[strings.ToLower(filepath.Ext(inputPath))] {
+		return g.ConvertHTML(ctx, in, out)
+	}
+	return g.ConvertOffice(ctx, filepath.Base(inputPath), in, out)
+}
+
+// ConvertOffice sends an office document through the LibreOffice route and streams the PDF to out.
+// filename must carry the original extension, which LibreOffice uses to detect the format.
+func (g *GotenbergConverter) ConvertOffice(ctx context.Context, filename string, in io.Reader, out io.Writer) error {
+	return g.post(ctx, gotenbergLibreOfficeRoute, filename, in, out)
+}
+
+// ConvertHTML renders an HTML page through the Chromium route and streams the PDF to out.
+func (g *GotenbergConverter) ConvertHTML(ctx context.Context, in io.Reader, out io.Writer) error {
+	// The Chromium route requires the entry page to be named index.html.
+	return g.post(ctx, gotenbergChromiumRoute, "index.html", in, out)
+}
+
+// post uploads in as a multipart "files" field without buffering it in memory.
+func (g *GotenbergConverter) post(ctx context.Context, route, filename string, in io.Reader, out io.Writer) error {
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+
+	go func() {
+		part, err := form.CreateFormFile("files", filename)
+		if err == nil {
+			_, err = io.Copy(part, in)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+route, body)
+	if err != nil {
+		body.Close()
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		body.Close()
+		return fmt.Errorf("gotenberg 요청 실패: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, gotenbergErrorBodyLimit))
+		return &GotenbergError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return fmt.Errorf("gotenberg 결과 수신 실패: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package fileconverter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGotenbergStub answers every conversion with "%PDF:<route>:<filename>:<content>".
+func newGotenbergStub(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("files")
+		if !assert.NoError(t, err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := io.ReadAll(file)
+
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write([]byte("%PDF:" + r.URL.Path + ":" + header.Filename + ":" + string(content)))
+	}))
+}
+
+func TestGotenbergConverterRoutes(t *testing.T) {
+	server := newGotenbergStub(t)
+	defer server.Close()
+
+	converter := NewGotenbergConverter(server.URL+"/", server.Client())
+	dir := t.TempDir()
+
+	for _, tc := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "office document", input: "plan.docx", expected: "%PDF:/forms/libreoffice/convert:plan.docx:data"},
+		{name: "html page", input: "page.HTML", expected: "%PDF:/forms/chromium/convert/html:index.html:data"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			inputPath := filepath.Join(dir, tc.input)
+			outputPath := filepath.Join(dir, "out", tc.input+".pdf")
+			require.NoError(t, os.WriteFile(inputPath, []byte("data"), 0600))
+
+			require.NoError(t, converter.Convert(context.Background(), inputPath, outputPath))
+
+			output, err := os.ReadFile(outputPath)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(output))
+		})
+	}
+}
+
+func TestGotenbergConverterError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unsupported format", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "drawing.xyz")
+	outputPath := filepath.Join(dir, "drawing.pdf")
+	require.NoError(t, os.WriteFile(inputPath, []byte("data"), 0600))
+
+	err := NewGotenbergConverter(server.URL, server.Client()).Convert(context.Background(), inputPath, outputPath)
+
+	var gotenbergErr *GotenbergError
+	require.ErrorAs(t, err, &gotenbergErr)
+	assert.Equal(t, http.StatusBadRequest, gotenbergErr.StatusCode)
+	assert.Equal(t, "unsupported format", gotenbergErr.Message)
+	assert.False(t, gotenbergErr.Temporary())
+	assert.NoFileExists(t, outputPath)
+}
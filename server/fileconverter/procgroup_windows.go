@@ -0,0 +1,11 @@
+//go:build windows
+
+package fileconverter
+
+import (
+	"os/exec"
+)
+
+// killProcessGroupOnCancel keeps the default behavior on Windows, where exec kills only the
+// direct child on cancellation.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {}
@@ -0,0 +1,150 @@
+package fileconverter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// killWaitDelay bounds how long we wait for the output pipes to close after the process group
+// was killed, in case a grandchild escaped the group and still holds them open.
+const killWaitDelay = 5 * time.Second
+
+// inheritedEnv lists the variables of the plugin process that convert.py may see. Everything
+// else, including the Mattermost server's own settings and secrets, is withheld.
+var inheritedEnv = []string{
+	"PATH",
+	"HOME",
+	"LANG",
+	"LC_ALL",
+	"TMPDIR",
+	"TEMP",
+	"TMP",
+	"SYSTEMROOT",
+}
+
+// PythonOptions configures the convert.py pipeline.
+type PythonOptions struct {
+	// PythonPath is the interpreter running the script, typically inside a virtualenv.
+	PythonPath string
+	// CollabviewRoot is the Collabview installation; the script lives in public/web/convert.py.
+	CollabviewRoot string
+	// DataRoot is the Mattermost local file storage directory.
+	DataRoot string
+	// OutputRoot is the directory convert.py writes <hash>/<name>.esob to. The script takes it
+	// from its own configuration, MATTERMOST_OUTPUT_ROOT, so it must match the plugin's
+	// MattermostOutput setting; it is also exported to the script under that name.
+	OutputRoot string
+	// Environ returns the parent environment the allow-list is applied to. Defaults to os.Environ.
+	Environ func() []string
+}
+
+// PythonConverter runs convert.py as a child process.
+type PythonConverter struct {
+	opts PythonOptions
+}
+
+// NewPythonConverter returns a converter running convert.py with the given options.
+func NewPythonConverter(opts PythonOptions) *PythonConverter {
+	if opts.Environ == nil {
+		opts.Environ = os.Environ
+	}
+	return &PythonConverter{opts: opts}
+}
+
+func (c *PythonConverter) Name() string { return PythonConverterName }
+
+func (c *PythonConverter) Supports(ext, mimeType string) bool { return true }
+
+func (c *PythonConverter) OutputExtension(ext string) string { return ".esob" }
+
+// Version fingerprints convert.py, so that editing the script invalidates the conversions
+// cached from its previous revision. It is empty when the script cannot be read.
+func (c *PythonConverter) Version() string {
+	script, err := os.ReadFile(c.ScriptPath())
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(script)
+	return hex.EncodeToString(sum[:6])
+}
+
+// ScriptPath returns the location of convert.py.
+func (c *PythonConverter) ScriptPath() string {
+	return filepath.Join(c.opts.CollabviewRoot, "public", "web", "convert.py")
+}
+
+// Convert runs the script with the output directory name as its hash, then moves the result
+// from <OutputRoot>/<hash>/<name>.esob to outputPath if the script wrote it elsewhere. The script and every process it spawns are
+// killed when ctx is canceled or its deadline passes.
+func (c *PythonConverter) Convert(ctx context.Context, inputPath, outputPath string) error {
+	if c.opts.CollabviewRoot == "" {
+		return fmt.Errorf("Collabview 경로가 설정되어 있지 않습니다")
+	}
+	if c.opts.PythonPath == "" {
+		return fmt.Errorf("Python 경로가 설정되어 있지 않습니다")
+	}
+
+	outputHash := filepath.Base(filepath.Dir(outputPath))
+	cmd := exec.CommandContext(ctx, c.opts.PythonPath, c.args(inputPath, outputHash)...)
+	cmd.Env = c.env()
+	killProcessGroupOnCancel(cmd)
+	cmd.WaitDelay = killWaitDelay
+
+	output, err := cmd.CombinedOutput()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("convert.py 실행 중단: %w\n 출력:\n%s", ctxErr, string(output))
+	}
+	if err != nil {
+		return fmt.Errorf("convert.py 실행 실패: %v\n 출력:\n%s", err, string(output))
+	}
+
+	base := filepath.Base(inputPath)
+	produced := filepath.Join(c.opts.OutputRoot, outputHash, strings.TrimSuffix(base, filepath.Ext(base))+".esob")
+	if produced == outputPath {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(produced, outputPath); err != nil {
+		return err
+	}
+	// The script's <hash> directory is left empty; anything else in it is not ours to remove.
+	_ = os.Remove(filepath.Dir(produced))
+	return nil
+}
+
+func (c *PythonConverter) args(inputPath, outputHash string) []string {
+	return []string{c.ScriptPath(), inputPath, "--gotenberg", outputHash}
+}
+
+// env builds the child environment from the allow-listed parent variables plus the paths the
+// script needs, which are passed explicitly rather than through the plugin's own environment.
+func (c *PythonConverter) env() []string {
+	allowed := make(map[string]bool, len(inheritedEnv))
+	for _, name := range inheritedEnv {
+		allowed[name] = true
+	}
+
+	var env []string
+	for _, entry := range c.opts.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if allowed[strings.ToUpper(name)] {
+			env = append(env, entry)
+		}
+	}
+
+	return append(env,
+		"COLLABVIEW_PUBLIC_ROOT="+c.opts.CollabviewRoot,
+		"PYTHON_PATH="+c.opts.PythonPath,
+		"MATTERMOST_DATA_ROOT="+c.opts.DataRoot,
+		"MATTERMOST_OUTPUT_ROOT="+c.opts.OutputRoot,
+	)
+}
@@ -0,0 +1,151 @@
+package fileconverter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPythonConverterEnv(t *testing.T) {
+	opts := PythonOptions{
+		PythonPath:     "/venv/bin/python",
+		CollabviewRoot: "/collabview",
+		DataRoot:       "/mattermost/data",
+		OutputRoot:     "/mattermost/output",
+	}
+
+	for _, tc := range []struct {
+		name     string
+		parent   []string
+		expected []string
+	}{
+		{
+			name:   "keeps allow-listed variables only",
+			parent: []string{"PATH=/usr/bin", "HOME=/home/mattermost", "MM_SQLSETTINGS_DATASOURCE=postgres://secret", "AWS_SECRET_ACCESS_KEY=secret"},
+			expected: []string{
+				"PATH=/usr/bin",
+				"HOME=/home/mattermost",
+			},
+		},
+		{
+			name:     "matches names case-insensitively",
+			parent:   []string{"Path=C:\\Windows", "SystemRoot=C:\\Windows"},
+			expected: []string{"Path=C:\\Windows", "SystemRoot=C:\\Windows"},
+		},
+		{
+			name:   "overrides inherited plugin paths",
+			parent: []string{"COLLABVIEW_PUBLIC_ROOT=/stale", "PYTHON_PATH=/stale/python"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			parent := tc.parent
+			opts.Environ = func() []string { return parent }
+
+			expected := append(tc.expected,
+				"COLLABVIEW_PUBLIC_ROOT=/collabview",
+				"PYTHON_PATH=/venv/bin/python",
+				"MATTERMOST_DATA_ROOT=/mattermost/data",
+				"MATTERMOST_OUTPUT_ROOT=/mattermost/output",
+			)
+			assert.Equal(t, expected, NewPythonConverter(opts).env())
+		})
+	}
+}
+
+func TestPythonConverterArgs(t *testing.T) {
+	converter := NewPythonConverter(PythonOptions{CollabviewRoot: "/collabview"})
+
+	assert.Equal(t,
+		[]string{filepath.Join("/collabview", "public", "web", "convert.py"), "/data/plan.pdf", "--gotenberg", "post-id"},
+		converter.args("/data/plan.pdf", "post-id"),
+	)
+}
+
+// fakeScript installs a shell script standing in for convert.py and returns converter options
+// running it through /bin/sh.
+func fakeScript(t *testing.T, body string) PythonOptions {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	root := t.TempDir()
+	web := filepath.Join(root, "collabview", "public", "web")
+	require.NoError(t, os.MkdirAll(web, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(web, "convert.py"), []byte(body), 0600))
+
+	return PythonOptions{
+		PythonPath:     "/bin/sh",
+		CollabviewRoot: filepath.Join(root, "collabview"),
+		OutputRoot:     filepath.Join(root, "output"),
+		Environ:        func() []string { return []string{"PATH=" + os.Getenv("PATH")} },
+	}
+}
+
+func TestPythonConverterConvert(t *testing.T) {
+	// $1 is the input file and $3 the output hash; the name is hard-coded for the test.
+	opts := fakeScript(t, `mkdir -p "$MATTERMOST_OUTPUT_ROOT/$3" && cp "$1" "$MATTERMOST_OUTPUT_ROOT/$3/plan.esob"`)
+
+	input := filepath.Join(t.TempDir(), "plan.pdf")
+	require.NoError(t, os.WriteFile(input, []byte("drawing"), 0600))
+	output := filepath.Join(t.TempDir(), "post-id", "artifact.esob")
+
+	require.NoError(t, NewPythonConverter(opts).Convert(context.Background(), input, output))
+
+	converted, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "drawing", string(converted))
+}
+
+func TestPythonConverterConvertMovesResultIntoWorkDir(t *testing.T) {
+	// The real convert.py writes below the output root of its own configuration and reads no
+	// variable for it, so the fake one hard-codes the root as well.
+	opts := fakeScript(t, "")
+	script := fmt.Sprintf(`unset MATTERMOST_OUTPUT_ROOT; mkdir -p %q/"$3" && cp "$1" %q/"$3/plan.esob"`, opts.OutputRoot, opts.OutputRoot)
+	require.NoError(t, os.WriteFile(NewPythonConverter(opts).ScriptPath(), []byte(script), 0600))
+
+	input := filepath.Join(t.TempDir(), "plan.pdf")
+	require.NoError(t, os.WriteFile(input, []byte("drawing"), 0600))
+	output := filepath.Join(opts.OutputRoot, ".collabview-work", "file-id", "plan.esob")
+
+	require.NoError(t, NewPythonConverter(opts).Convert(context.Background(), input, output))
+
+	converted, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "drawing", string(converted))
+	assert.NoDirExists(t, filepath.Join(opts.OutputRoot, "file-id"), "the script's directory is not left behind")
+}
+
+func TestPythonConverterTimeout(t *testing.T) {
+	opts := fakeScript(t, `sleep 30`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err := NewPythonConverter(opts).Convert(ctx, "/missing/plan.pdf", filepath.Join(t.TempDir(), "post-id", "plan.esob"))
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(started), 10*time.Second)
+}
+
+func TestPythonConverterVersion(t *testing.T) {
+	root := t.TempDir()
+	converter := NewPythonConverter(PythonOptions{CollabviewRoot: root})
+	assert.Empty(t, converter.Version(), "no script, no cacheable version")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "public", "web"), 0700))
+	require.NoError(t, os.WriteFile(converter.ScriptPath(), []byte("print('v1')"), 0600))
+	v1 := converter.Version()
+	assert.NotEmpty(t, v1)
+	assert.Equal(t, v1, converter.Version())
+
+	require.NoError(t, os.WriteFile(converter.ScriptPath(), []byte("print('v2')"), 0600))
+	assert.NotEqual(t, v1, converter.Version(), "editing the script changes the version")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+	"github.com/pkg/errors"
+
+	"github.com/jyoonje/collabview_plugin/server/config"
+)
+
+// stagingDirName is the workspace under the plugin's working directory where attachments read
+// through the file API are written before conversion.
+const stagingDirName = ".staging"
+
+// stageInput returns a local path holding the attachment's content and a cleanup function to
+// call once the conversion is done. The file is read in place when Mattermost stores it on the
+// local disk we can see; otherwise, e.g. with S3 storage or on another cluster node, it is
+// read through the file API into a temporary workspace. The file API returns the whole content
+// in memory, so attachments above MaxInputFileSize are refused before they are read.
+func (p *Plugin) stageInput(cfg *activeConfig, fileInfo *model.FileInfo) (string, func(), error) {
+	if localPath, ok := p.localFilePath(cfg, fileInfo); ok {
+		return localPath, func() {}, nil
+	}
+
+	if limit := cfg.MaxInputFileSize(); fileInfo.Size > limit {
+		return "", nil, permanent(errors.Errorf("첨부 파일 크기 제한 초과: %d bytes (최대 %d bytes)", fileInfo.Size, limit))
+	}
+
+	workspace := filepath.Join(cfg.WorkDir(), stagingDirName, fileInfo.Id)
+	cleanup := func() {
+		if err := os.RemoveAll(workspace); err != nil {
+			p.API.LogWarn("임시 작업 디렉토리 삭제 실패", "path", workspace, "error", err.Error())
+		}
+	}
+	if err := os.MkdirAll(workspace, os.ModePerm); err != nil {
+		return "", nil, errors.Wrapf(err, "임시 작업 디렉토리 생성 실패: %s", workspace)
+	}
+
+	stagedPath := filepath.Join(workspace, config.InputFileName(fileInfo.Name))
+	if err := p.downloadFile(fileInfo.Id, stagedPath, cfg.MaxInputFileSize()); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	p.API.LogInfo("파일 API로 첨부 파일 수신", "fileID", fileInfo.Id, "path", stagedPath)
+	return stagedPath, cleanup, nil
+}
+
+// localFilePath reports whether the attachment can be read directly from the data directory:
+// the local driver must be in use and the file on disk must have the expected size.
+func (p *Plugin) localFilePath(cfg *activeConfig, fileInfo *model.FileInfo) (string, bool) {
+	if cfg.MattermostDataRoot == "" {
+		return "", false
+	}
+
+	fileSettings := p.API.GetConfig().FileSettings
+	if fileSettings.DriverName == nil || *fileSettings.DriverName != model.ImageDriverLocal {
+		return "", false
+	}
+
+	localPath := filepath.Join(cfg.MattermostDataRoot, fileInfo.Path)
+	info, err := os.Stat(localPath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != fileInfo.Size {
+		return "", false
+	}
+	return localPath, true
+}
+
+// downloadFile writes the attachment's content from the file API into dst. The size recorded in
+// the file info is checked beforehand, but the copy is bounded as well in case it is stale.
+func (p *Plugin) downloadFile(fileID, dst string, limit int64) (err error) {
+	content, err := p.client.File.Get(fileID)
+	if err != nil {
+		if errors.Is(err, pluginapi.ErrNotFound) {
+			return permanent(errors.Wrap(err, "파일 내용 조회 실패"))
+		}
+		return errors.Wrap(err, "파일 내용 조회 실패")
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return errors.Wrapf(err, "임시 파일 생성 실패: %s", dst)
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil && closeErr != nil {
+			err = errors.Wrapf(closeErr, "임시 파일 저장 실패: %s", dst)
+		}
+	}()
+
+	written, err := io.Copy(out, io.LimitReader(content, limit+1))
+	if err != nil {
+		return errors.Wrapf(err, "임시 파일 저장 실패: %s", dst)
+	}
+	if written > limit {
+		return permanent(errors.Errorf("첨부 파일 크기 제한 초과: 최대 %d bytes", limit))
+	}
+	return nil
+}
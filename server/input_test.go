@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageInput(t *testing.T) {
+	dataRoot := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dataRoot, "20240101"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dataRoot, "20240101", "plan.pdf"), []byte("local"), 0600))
+
+	for _, tc := range []struct {
+		name       string
+		driver     string
+		size       int64
+		expectDisk bool
+	}{
+		{name: "local driver with the file on disk", driver: model.ImageDriverLocal, size: 5, expectDisk: true},
+		{name: "local driver with a size mismatch", driver: model.ImageDriverLocal, size: 42},
+		{name: "S3 driver", driver: model.ImageDriverS3, size: 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, api, _ := newTestPlugin(t)
+			cfg := p.snapshot()
+			cfg.MattermostDataRoot = dataRoot
+			cfg.MattermostOutput = t.TempDir()
+
+			api.On("GetConfig").Return(&model.Config{FileSettings: model.FileSettings{DriverName: model.NewPointer(tc.driver)}})
+			api.On("GetFile", "file-id").Return([]byte("remote"), nil)
+			api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+			fileInfo := &model.FileInfo{Id: "file-id", Name: "plan.pdf", Path: "20240101/plan.pdf", Size: tc.size}
+
+			path, cleanup, err := p.stageInput(cfg, fileInfo)
+			require.NoError(t, err)
+
+			content, err := os.ReadFile(path)
+			require.NoError(t, err)
+			if tc.expectDisk {
+				assert.Equal(t, "local", string(content))
+				api.AssertNotCalled(t, "GetFile", "file-id")
+			} else {
+				assert.Equal(t, "remote", string(content))
+				assert.Equal(t, "plan.pdf", filepath.Base(path))
+			}
+
+			cleanup()
+			if !tc.expectDisk {
+				assert.NoFileExists(t, path)
+			}
+		})
+	}
+}
+
+func TestStageInputSanitizesTheName(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	cfg := p.snapshot()
+	cfg.MattermostOutput = t.TempDir()
+
+	api.On("GetConfig").Return(&model.Config{FileSettings: model.FileSettings{DriverName: model.NewPointer(model.ImageDriverS3)}})
+	api.On("GetFile", "file-id").Return([]byte("remote"), nil)
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	fileInfo := &model.FileInfo{Id: "file-id", Name: `..\도면<v2>.dwg`, Size: 6}
+	path, cleanup, err := p.stageInput(cfg, fileInfo)
+	require.NoError(t, err)
+	defer cleanup()
+
+	assert.Equal(t, filepath.Join(cfg.WorkDir(), stagingDirName, "file-id", "도면_v2_.dwg"), path)
+	assert.FileExists(t, path)
+}
+
+func TestStageInputRefusesLargeFiles(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	cfg := p.snapshot()
+	cfg.MattermostOutput = t.TempDir()
+	cfg.MaxInputFileSizeMB = 1
+
+	api.On("GetConfig").Return(&model.Config{FileSettings: model.FileSettings{DriverName: model.NewPointer(model.ImageDriverS3)}})
+
+	t.Run("size known beforehand", func(t *testing.T) {
+		fileInfo := &model.FileInfo{Id: "file-id", Name: "plan.pdf", Size: 2 << 20}
+
+		_, _, err := p.stageInput(cfg, fileInfo)
+		require.Error(t, err)
+		assert.True(t, isPermanent(err))
+		api.AssertNotCalled(t, "GetFile", "file-id")
+	})
+
+	t.Run("size recorded too low", func(t *testing.T) {
+		api.On("GetFile", "stale-id").Return(make([]byte, 1<<20+1), nil)
+		fileInfo := &model.FileInfo{Id: "stale-id", Name: "plan.pdf", Size: 5}
+
+		_, _, err := p.stageInput(cfg, fileInfo)
+		require.Error(t, err)
+		assert.True(t, isPermanent(err))
+		assert.NoDirExists(t, filepath.Join(cfg.WorkDir(), stagingDirName, "stale-id"))
+	})
+}
@@ -1,6 +1,349 @@
 package main
 
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+
+	"github.com/jyoonje/collabview_plugin/server/store/artifactstore"
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+// staleFileMinAge is how old a working file must at least be before the sweep treats it as
+// left behind by an interrupted conversion. Files younger than twice the conversion timeout
+// may still belong to a running conversion and are never touched.
+const staleFileMinAge = time.Hour
+
+// runJob is the hourly maintenance sweep, followed by reconciliation when channels are
+// configured for it. It is scheduled on a single node of the cluster.
 func (p *Plugin) runJob() {
-	// Include job logic here
-	p.client.Log.Info("Job is currently running")
+	cfg := p.snapshot()
+	if cfg == nil {
+		return
+	}
+
+	ctx := context.Background()
+	report := p.sweep(ctx, cfg, time.Now())
+	if err := p.kvstore.SaveMaintenanceReport(report); err != nil {
+		p.API.LogError("유지보수 결과 저장 실패", "error", err.Error())
+	}
+	p.API.LogInfo("유지보수 작업 완료",
+		"expiredArtifacts", report.ExpiredArtifacts,
+		"orphanedArtifacts", report.OrphanedArtifacts,
+		"staleTempFiles", report.StaleTempFiles,
+		"compactedJobs", report.CompactedJobs,
+		"prunedAuditRecords", report.PrunedAuditRecords,
+		"reclaimedBytes", report.ReclaimedBytes,
+		"errors", len(report.Errors),
+	)
+
+	if len(cfg.ReconcileChannels()) > 0 {
+		p.logReconcileReport(p.reconcile(ctx, cfg, time.Now()))
+	}
+}
+
+// sweep reclaims what the event hooks could not: expired artifacts, artifacts of posts deleted
+// while the plugin was not running, leftovers of interrupted conversions, old job records and
+// old cleanup audit records.
+// A failing step is recorded in the report and the sweep moves on to the next one.
+func (p *Plugin) sweep(ctx context.Context, cfg *activeConfig, now time.Time) *kvstore.MaintenanceReport {
+	report := &kvstore.MaintenanceReport{StartedAt: now.UnixMilli()}
+
+	if artifacts, err := p.kvstore.ListArtifacts(); err != nil {
+		p.sweepFailed(report, "artifacts", err)
+	} else {
+		artifacts = p.expireArtifacts(ctx, cfg, artifacts, now, report)
+		p.removeOrphanedArtifacts(ctx, cfg, artifacts, now, report)
+	}
+	p.purgeTempFiles(ctx, cfg, now, report)
+	p.compactJobs(cfg, now, report)
+	p.pruneAuditRecords(cfg, now, report)
+
+	report.FinishedAt = model.GetMillis()
+	return report
+}
+
+func (p *Plugin) sweepFailed(report *kvstore.MaintenanceReport, step string, err error) {
+	p.API.LogError("유지보수 단계 실패", "step", step, "error", err.Error())
+	report.Errors = append(report.Errors, step+": "+err.Error())
+}
+
+// expireArtifacts removes the artifacts published longer ago than the retention period, leaving
+// an expired status in place of their conversion status, and returns the manifest entries that
+// were kept.
+func (p *Plugin) expireArtifacts(ctx context.Context, cfg *activeConfig, artifacts []*kvstore.Artifact, now time.Time, report *kvstore.MaintenanceReport) []*kvstore.Artifact {
+	retention := cfg.ArtifactRetention()
+	if retention <= 0 {
+		return artifacts
+	}
+
+	cutoff := now.Add(-retention).UnixMilli()
+	var kept []*kvstore.Artifact
+	var fileIDs, removedKeys []string
+	for _, artifact := range artifacts {
+		if artifact.PublishedAt >= cutoff {
+			kept = append(kept, artifact)
+			continue
+		}
+		key, err := p.removeFileArtifacts(ctx, cfg, artifact.FileID)
+		if err != nil {
+			p.sweepFailed(report, "expire "+artifact.FileID, err)
+			continue
+		}
+		tombstone := &kvstore.ConversionStatus{
+			FileID:    artifact.FileID,
+			PostID:    artifact.PostID,
+			State:     kvstore.ConversionStateExpired,
+			Converter: artifact.Converter,
+			Format:    artifact.Format,
+			UpdatedAt: model.GetMillis(),
+		}
+		if err := p.kvstore.SaveConversionStatus(tombstone); err != nil {
+			p.sweepFailed(report, "expire "+artifact.FileID, err)
+		}
+		fileIDs = append(fileIDs, artifact.FileID)
+		if key != "" {
+			removedKeys = append(removedKeys, key)
+			report.ExpiredArtifacts++
+			report.ReclaimedBytes += artifact.Size
+		}
+	}
+	p.auditSweep("", fileIDs, removedKeys, kvstore.CleanupReasonExpired, now)
+	return kept
+}
+
+// orphanCandidate gathers what the artifact store and the manifest hold for one post.
+type orphanCandidate struct {
+	stored   []artifactstore.Info
+	manifest []*kvstore.Artifact
+}
+
+// removeOrphanedArtifacts removes the artifacts and manifest entries of posts that no longer
+// exist, e.g. because they were deleted while the plugin was disabled.
+func (p *Plugin) removeOrphanedArtifacts(ctx context.Context, cfg *activeConfig, artifacts []*kvstore.Artifact, now time.Time, report *kvstore.MaintenanceReport) {
+	stored, err := cfg.artifacts.List(ctx, "")
+	if err != nil {
+		p.sweepFailed(report, "list artifacts", err)
+		return
+	}
+
+	posts := map[string]*orphanCandidate{}
+	candidate := func(postID string) *orphanCandidate {
+		if posts[postID] == nil {
+			posts[postID] = &orphanCandidate{}
+		}
+		return posts[postID]
+	}
+	for _, info := range stored {
+		// Keys start with the post ID; anything else was not published by this plugin.
+		postID, _, ok := strings.Cut(info.Key, "/")
+		if !ok || !model.IsValidId(postID) {
+			continue
+		}
+		candidate(postID).stored = append(candidate(postID).stored, info)
+	}
+	for _, artifact := range artifacts {
+		candidate(artifact.PostID).manifest = append(candidate(artifact.PostID).manifest, artifact)
+	}
+
+	for postID, orphan := range posts {
+		exists, err := p.postExists(postID)
+		if err != nil {
+			p.sweepFailed(report, "get post "+postID, err)
+			continue
+		}
+		if exists {
+			continue
+		}
+
+		sizes := make(map[string]int64, len(orphan.stored))
+		for _, info := range orphan.stored {
+			sizes[info.Key] = info.Size
+		}
+		var fileIDs, removedKeys []string
+		for _, artifact := range orphan.manifest {
+			if _, err := p.removeFileArtifacts(ctx, cfg, artifact.FileID); err != nil {
+				p.sweepFailed(report, "remove orphan "+artifact.FileID, err)
+				delete(sizes, artifact.Key)
+				continue
+			}
+			fileIDs = append(fileIDs, artifact.FileID)
+			if size, ok := sizes[artifact.Key]; ok {
+				removedKeys = append(removedKeys, artifact.Key)
+				report.OrphanedArtifacts++
+				report.ReclaimedBytes += size
+				delete(sizes, artifact.Key)
+			}
+		}
+		// What is left has no manifest entry, e.g. artifacts published before manifests existed.
+		for key, size := range sizes {
+			if err := cfg.artifacts.Delete(ctx, key); err != nil {
+				p.sweepFailed(report, "remove orphan "+key, err)
+				continue
+			}
+			removedKeys = append(removedKeys, key)
+			report.OrphanedArtifacts++
+			report.ReclaimedBytes += size
+		}
+		slices.Sort(removedKeys)
+		p.auditSweep(postID, fileIDs, removedKeys, kvstore.CleanupReasonOrphaned, now)
+	}
+}
+
+// postExists reports whether the post can still be read. Deleted posts are reported as missing.
+func (p *Plugin) postExists(postID string) (bool, error) {
+	_, appErr := p.API.GetPost(postID)
+	if appErr == nil {
+		return true, nil
+	}
+	if appErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return false, appErr
+}
+
+// auditSweep records the removals of a sweep step like those of a cleanup task.
+func (p *Plugin) auditSweep(postID string, fileIDs, removedKeys []string, reason kvstore.CleanupReason, now time.Time) {
+	if len(fileIDs) == 0 && len(removedKeys) == 0 {
+		return
+	}
+	record := &kvstore.AuditRecord{
+		ID:          model.NewId(),
+		PostID:      postID,
+		FileIDs:     fileIDs,
+		Reason:      reason,
+		RemovedKeys: removedKeys,
+		Attempts:    1,
+		RequestedAt: now.UnixMilli(),
+		CompletedAt: model.GetMillis(),
+	}
+	if err := p.kvstore.AddAuditRecord(record); err != nil {
+		p.API.LogError(".esob 파일 정리 감사 기록 저장 실패", "reason", reason, "error", err.Error())
+	}
+}
+
+// purgeTempFiles removes the leftovers of interrupted conversions from the plugin's working
+// directory and the unfinished writes of the artifact store. Nothing else under
+// MattermostOutput is touched.
+func (p *Plugin) purgeTempFiles(ctx context.Context, cfg *activeConfig, now time.Time, report *kvstore.MaintenanceReport) {
+	before := now.Add(-max(staleFileMinAge, 2*cfg.Timeout()))
+
+	if cfg.MattermostOutput != "" {
+		count, size, err := purgeStaleFiles(cfg.WorkDir(), before)
+		report.StaleTempFiles += count
+		report.ReclaimedBytes += size
+		if err != nil {
+			p.sweepFailed(report, "purge working directory", err)
+		}
+	}
+
+	if purger, ok := cfg.artifacts.(artifactstore.Purger); ok {
+		count, size, err := purger.PurgeTemp(ctx, before)
+		report.StaleTempFiles += count
+		report.ReclaimedBytes += size
+		if err != nil {
+			p.sweepFailed(report, "purge artifact store", err)
+		}
+	}
+}
+
+// purgeStaleFiles removes the files under root last modified before the given time, then the
+// directories left empty.
+func purgeStaleFiles(root string, before time.Time) (int, int64, error) {
+	var (
+		count int
+		size  int64
+		dirs  []string
+	)
+	dirModTimes := map[string]time.Time{}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			// Removing the files below updates the directory, so its age is taken first.
+			if info, err := entry.Info(); err == nil && path != root {
+				dirs = append(dirs, path)
+				dirModTimes[path] = info.ModTime()
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		count++
+		size += info.Size()
+		return nil
+	})
+
+	// Deepest directories first, so that parents become empty in turn. A directory that is
+	// still recent may have just been created for a conversion about to write into it.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if dirModTimes[dirs[i]].Before(before) {
+			_ = os.Remove(dirs[i])
+		}
+	}
+	if err != nil {
+		return count, size, errors.Wrapf(err, "임시 파일 정리 실패: %s", root)
+	}
+	return count, size, nil
+}
+
+// compactJobs removes the records of jobs that finished longer ago than the job retention.
+// Failed jobs stay reachable through their dead-letter entry.
+func (p *Plugin) compactJobs(cfg *activeConfig, now time.Time, report *kvstore.MaintenanceReport) {
+	jobs, err := p.kvstore.ListJobs()
+	if err != nil {
+		p.sweepFailed(report, "list jobs", err)
+		return
+	}
+
+	cutoff := now.Add(-cfg.JobRetention()).UnixMilli()
+	for _, job := range jobs {
+		if !job.IsFinished() || job.UpdatedAt >= cutoff {
+			continue
+		}
+		if err := p.kvstore.DeleteJob(job.ID); err != nil {
+			p.sweepFailed(report, "delete job "+job.ID, err)
+			continue
+		}
+		report.CompactedJobs++
+	}
+}
+
+// pruneAuditRecords removes the cleanup audit records completed longer ago than the audit
+// retention, so that the audit trail does not grow without bound.
+func (p *Plugin) pruneAuditRecords(cfg *activeConfig, now time.Time, report *kvstore.MaintenanceReport) {
+	records, err := p.kvstore.ListAuditRecords()
+	if err != nil {
+		p.sweepFailed(report, "list audit records", err)
+		return
+	}
+
+	cutoff := now.Add(-cfg.AuditRetention()).UnixMilli()
+	for _, record := range records {
+		if record.CompletedAt >= cutoff {
+			continue
+		}
+		if err := p.kvstore.DeleteAuditRecord(record.ID); err != nil {
+			p.sweepFailed(report, "delete audit record "+record.ID, err)
+			continue
+		}
+		report.PrunedAuditRecords++
+	}
 }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+func TestPurgeTempFiles(t *testing.T) {
+	p, _, _ := newTestPlugin(t)
+	cfg := p.snapshot()
+	cfg.MattermostOutput = t.TempDir()
+	cfg.TimeoutSeconds = 60
+
+	old := time.Now().Add(-3 * time.Hour)
+	write := func(path string) string {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, []byte("data"), 0600))
+		require.NoError(t, os.Chtimes(path, old, old))
+		return path
+	}
+	leftover := write(filepath.Join(cfg.WorkDir(), "file1", "plan.esob"))
+	unrelated := write(filepath.Join(cfg.MattermostOutput, "reports", "2023.pdf"))
+
+	report := &kvstore.MaintenanceReport{}
+	p.purgeTempFiles(context.Background(), cfg, time.Now(), report)
+
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, 1, report.StaleTempFiles)
+	assert.NoFileExists(t, leftover)
+	assert.FileExists(t, unrelated, "only the plugin's working directory is purged")
+}
+
+func TestPurgeStaleFiles(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().Add(-3 * time.Hour)
+	write := func(name string, stale bool) string {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, []byte("data"), 0600))
+		if stale {
+			require.NoError(t, os.Chtimes(path, old, old))
+		}
+		return path
+	}
+
+	staged := write(".staging/file1/plan.pdf", true)
+	converted := write("file2/plan.esob", true)
+	running := write(".staging/file3/plan.pdf", false)
+	for _, dir := range []string{".staging", ".staging/file1", "file2"} {
+		require.NoError(t, os.Chtimes(filepath.Join(root, dir), old, old))
+	}
+
+	count, size, err := purgeStaleFiles(root, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.EqualValues(t, 8, size)
+
+	assert.NoFileExists(t, staged)
+	assert.NoFileExists(t, converted)
+	assert.NoDirExists(t, filepath.Join(root, ".staging", "file1"), "emptied directories are removed")
+	assert.NoDirExists(t, filepath.Join(root, "file2"))
+	assert.FileExists(t, running, "a conversion still running keeps its files")
+	assert.DirExists(t, filepath.Join(root, ".staging"), "a directory that is not empty is kept")
+
+	count, _, err = purgeStaleFiles(filepath.Join(root, "missing"), time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestRemoveOrphanedArtifacts(t *testing.T) {
+	p, api, store := newTestPlugin(t)
+	cfg := p.snapshot()
+
+	ctx := context.Background()
+	livePost, deletedPost := model.NewId(), model.NewId()
+	liveKey := livePost + "/file1/plan.esob"
+	orphanKey := deletedPost + "/file2/site.esob"
+	require.NoError(t, store.Put(ctx, liveKey, strings.NewReader("live"), 4))
+	require.NoError(t, store.Put(ctx, orphanKey, strings.NewReader("orphan"), 6))
+	require.NoError(t, store.Put(ctx, "unrelated/readme.txt", strings.NewReader("keep"), 4))
+
+	api.On("GetPost", livePost).Return(&model.Post{Id: livePost}, nil)
+	api.On("GetPost", deletedPost).Return(nil, model.NewAppError("GetPost", "app.post.get.app_error", nil, "", http.StatusNotFound))
+	api.On("KVSetWithOptions", mock.MatchedBy(func(key string) bool { return strings.HasPrefix(key, "audit-") }), mock.Anything, mock.Anything).Return(true, nil).Once()
+
+	report := &kvstore.MaintenanceReport{}
+	p.removeOrphanedArtifacts(ctx, cfg, nil, time.Now(), report)
+
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, 1, report.OrphanedArtifacts)
+	assert.EqualValues(t, 6, report.ReclaimedBytes)
+	assert.NoFileExists(t, filepath.Join(store.Root(), filepath.FromSlash(orphanKey)))
+	assert.FileExists(t, filepath.Join(store.Root(), filepath.FromSlash(liveKey)))
+	assert.FileExists(t, filepath.Join(store.Root(), "unrelated", "readme.txt"))
+	api.AssertExpectations(t)
+}
+
+func TestPruneAuditRecords(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	cfg := p.snapshot()
+	cfg.AuditRetentionDays = 30
+
+	kv := map[string][]byte{}
+	kvMemory(api, kv)
+	now := time.Now()
+	for id, completedAt := range map[string]time.Time{"old": now.Add(-31 * 24 * time.Hour), "recent": now.Add(-29 * 24 * time.Hour)} {
+		require.NoError(t, p.kvstore.AddAuditRecord(&kvstore.AuditRecord{ID: id, CompletedAt: completedAt.UnixMilli()}))
+	}
+
+	report := &kvstore.MaintenanceReport{}
+	p.pruneAuditRecords(cfg, now, report)
+
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, 1, report.PrunedAuditRecords)
+	assert.NotContains(t, kv, "audit-old")
+	assert.Contains(t, kv, "audit-recent")
+}
+
+func TestExpireArtifactsLeavesTombstone(t *testing.T) {
+	p, api, store := newTestPlugin(t)
+	cfg := p.snapshot()
+	cfg.ArtifactRetentionDays = 30
+
+	kv := map[string][]byte{}
+	kvMemory(api, kv)
+	ctx := context.Background()
+	now := time.Now()
+	expired := &kvstore.Artifact{FileID: "old", PostID: "post", Key: "post/old/plan.esob", Format: "esob", Size: 3, PublishedAt: now.Add(-31 * 24 * time.Hour).UnixMilli()}
+	recent := &kvstore.Artifact{FileID: "new", PostID: "post", Key: "post/new/plan.esob", Format: "esob", Size: 3, PublishedAt: now.Add(-time.Hour).UnixMilli()}
+	for _, artifact := range []*kvstore.Artifact{expired, recent} {
+		require.NoError(t, store.Put(ctx, artifact.Key, strings.NewReader("esob"), 4))
+		require.NoError(t, p.kvstore.SaveArtifact(artifact))
+		require.NoError(t, p.kvstore.SaveConversionStatus(&kvstore.ConversionStatus{FileID: artifact.FileID, State: kvstore.ConversionStateSucceeded, ArtifactKey: artifact.Key}))
+	}
+
+	report := &kvstore.MaintenanceReport{}
+	kept := p.expireArtifacts(ctx, cfg, []*kvstore.Artifact{expired, recent}, now, report)
+
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, []*kvstore.Artifact{recent}, kept)
+	assert.Equal(t, 1, report.ExpiredArtifacts)
+
+	status, err := p.kvstore.GetConversionStatus("old")
+	require.NoError(t, err)
+	require.NotNil(t, status)
+	assert.Equal(t, kvstore.ConversionStateExpired, status.State)
+	assert.Empty(t, status.ArtifactKey)
+
+	problem, err := p.checkArtifact(ctx, cfg, "old")
+	require.NoError(t, err)
+	assert.Empty(t, problem, "reconciliation does not convert an expired file again")
+}
@@ -2,10 +2,9 @@
 package main
 
 import (
-	"io"
-	"os"
-	"path/filepath"
+	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
@@ -15,8 +14,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/jyoonje/collabview_plugin/server/command"
-	"github.com/jyoonje/collabview_plugin/server/config"
-	"github.com/jyoonje/collabview_plugin/server/fileconverter"
 	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
 )
 
@@ -28,22 +25,45 @@ type Plugin struct {
 	backgroundJob     *cluster.Job
 	configuration     *configuration
 	configurationLock sync.RWMutex
-	cfg               *config.Config
+	active            atomic.Pointer[activeConfig]
+
+	// pool is swapped on activation and deactivation while hooks and configuration changes read it.
+	pool atomic.Pointer[workerPool]
+	// cleanups runs the artifact cleanup tasks and their retries until deactivation.
+	cleanups atomic.Pointer[cleanupRunner]
+
+	// backfillCtx is canceled on deactivation to interrupt the running backfills.
+	backfillCtx   context.Context
+	stopBackfills context.CancelFunc
 }
 
 func (p *Plugin) OnActivate() error {
 	p.client = pluginapi.NewClient(p.MattermostPlugin.API, p.MattermostPlugin.Driver)
 	p.kvstore = kvstore.NewKVStore(p.client)
-	p.commandClient = command.NewCommandHandler(p.client)
+	p.commandClient = command.NewCommandHandler(p.client, p, p)
 
-	p.cfg = config.Load(p.API)
-	if p.cfg == nil {
-		return errors.New("failed to load plugin configuration")
+	if err := p.applyConfiguration(p.getConfiguration()); err != nil {
+		return err
 	}
 
-	_ = os.Setenv("COLLABVIEW_PUBLIC_ROOT", p.cfg.CollabviewRoot)
-	_ = os.Setenv("PYTHON_PATH", p.cfg.PythonPath)
-	_ = os.Setenv("MATTERMOST_DATA_ROOT", p.cfg.MattermostDataRoot)
+	pool := p.startWorkers()
+	go func() {
+		if err := p.resumePendingJobs(pool); err != nil {
+			p.API.LogError("미완료 변환 작업 재개 실패", "error", err.Error())
+		}
+	}()
+	p.cleanups.Store(newCleanupRunner())
+	go func() {
+		if err := p.resumeCleanupTasks(); err != nil {
+			p.API.LogError("미완료 .esob 파일 정리 작업 재개 실패", "error", err.Error())
+		}
+	}()
+	p.backfillCtx, p.stopBackfills = context.WithCancel(context.Background())
+	go func() {
+		if err := p.resumeBackfills(); err != nil {
+			p.API.LogError("미완료 과거 첨부 파일 변환 재개 실패", "error", err.Error())
+		}
+	}()
 
 	job, err := cluster.Schedule(
 		p.MattermostPlugin.API,
@@ -64,6 +84,14 @@ func (p *Plugin) OnDeactivate() error {
 			p.client.Log.Error("Failed to close background job", "err", err)
 		}
 	}
+	if p.stopBackfills != nil {
+		p.stopBackfills()
+	}
+	if cleanups := p.cleanups.Swap(nil); cleanups != nil {
+		cleanups.stop()
+	}
+	p.shutdownWorkers()
+	p.active.Store(nil)
 	return nil
 }
 
@@ -75,68 +103,51 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 	return response, nil
 }
 
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer sourceFile.Close()
-	destFile, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
-	_, err = io.Copy(destFile, sourceFile)
-	return err
-}
-
 func (p *Plugin) MessageHasBeenPosted(c *plugin.Context, post *model.Post) {
-	if len(post.FileIds) == 0 || p.cfg == nil {
+	if len(post.FileIds) == 0 || p.snapshot() == nil {
 		return
 	}
 
 	p.client.Log.Info("MessageHasBeenPosted: 첨부 파일이 있는 게시글 감지", "postID", post.Id)
 
-	go func(post *model.Post) {
-		for _, fileID := range post.FileIds {
-			fileInfo, appErr := p.API.GetFileInfo(fileID)
-			if appErr != nil {
-				p.API.LogError("파일 정보 조회 실패", "fileID", fileID, "error", appErr.Error())
-				continue
-			}
-
-			p.API.LogInfo("첨부된 파일 정보", "fileID", fileInfo.Id, "이름", fileInfo.Name, "저장 위치", fileInfo.Path)
-
-			filePath := filepath.Join(p.cfg.MattermostDataRoot, fileInfo.Path)
-
-			if err := fileconverter.ConvertToEsob(filePath, post.Id); err != nil {
-				p.API.LogError("파일 변환 실패", "fileID", fileID, "error", err.Error())
-				continue
-			}
+	for _, fileID := range post.FileIds {
+		if _, err := p.enqueueConversion(post, fileID); err != nil {
+			p.API.LogError("변환 작업 등록 실패", "postID", post.Id, "fileID", fileID, "error", err.Error())
+		}
+	}
+}
 
-			p.API.LogInfo("파일 변환 성공 및 저장 완료", "fileID", fileID)
+// MessageHasBeenUpdated keeps the artifacts in line with what an edited post shows: files
+// attached by the edit are converted, and the artifacts of detached files are removed.
+func (p *Plugin) MessageHasBeenUpdated(c *plugin.Context, newPost, oldPost *model.Post) {
+	if p.snapshot() == nil {
+		return
+	}
 
-			sourceFile := config.GetConvertedFilePath(post.Id, fileInfo.Name)
-			destFile := config.GetFinalOutputPath(post.Id, fileInfo.Name)
-			destDir := filepath.Dir(destFile)
+	added, removed := diffFileIDs(oldPost.FileIds, newPost.FileIds)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
 
-			if err := config.EnsureDir(destDir); err != nil {
-				p.API.LogError("변환 파일 대상 디렉토리 생성 실패", "path", destDir, "error", err.Error())
-				return
-			}
+	p.client.Log.Info("MessageHasBeenUpdated: 첨부 파일 변경 감지", "postID", newPost.Id, "added", len(added), "removed", len(removed))
 
-			if err := copyFile(sourceFile, destFile); err != nil {
-				p.API.LogError(".esob 파일 복사 실패", "from", sourceFile, "to", destFile, "error", err.Error())
-				return
-			}
+	for _, fileID := range added {
+		if _, err := p.enqueueConversion(newPost, fileID); err != nil {
+			p.API.LogError("변환 작업 등록 실패", "postID", newPost.Id, "fileID", fileID, "error", err.Error())
+		}
+	}
+	if len(removed) > 0 {
+		p.scheduleArtifactRemoval(newPost.Id, removed, kvstore.CleanupReasonFilesDetached)
+	}
+}
 
-			p.API.LogInfo(".esob 파일 복사 성공", "from", sourceFile, "to", destFile)
+// MessageHasBeenDeleted removes every artifact, cache entry and status record of the deleted
+// post's attachments, so that the documents can no longer be opened in Collabview.
+func (p *Plugin) MessageHasBeenDeleted(c *plugin.Context, post *model.Post) {
+	if len(post.FileIds) == 0 || p.snapshot() == nil {
+		return
+	}
 
-			if err := os.Remove(sourceFile); err != nil {
-				p.API.LogError("원본 .esob 파일 삭제 실패", "path", sourceFile, "error", err.Error())
-			} else {
-				p.API.LogInfo("원본 .esob 파일 삭제 완료", "path", sourceFile)
-			}
-		}
-	}(post)
+	p.client.Log.Info("MessageHasBeenDeleted: 첨부 파일이 있는 게시글 삭제 감지", "postID", post.Id)
+	p.scheduleArtifactRemoval(post.Id, post.FileIds, kvstore.CleanupReasonPostDeleted)
 }
@@ -1,14 +1,40 @@
 package main
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/pluginapi"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jyoonje/collabview_plugin/server/config"
+	"github.com/jyoonje/collabview_plugin/server/store/artifactstore"
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
 )
 
+// newTestPlugin returns an active plugin on top of the API mock, publishing to a local artifact
+// store in a temporary directory. Tests adjust the configuration through p.snapshot().
+func newTestPlugin(t *testing.T) (*Plugin, *plugintest.API, *artifactstore.LocalStore) {
+	t.Helper()
+	api := &plugintest.API{}
+	client := pluginapi.NewClient(api, &plugintest.Driver{})
+	p := &Plugin{client: client, kvstore: kvstore.NewKVStore(client)}
+	p.SetAPI(api)
+
+	store := artifactstore.NewLocalStore(t.TempDir())
+	p.active.Store(&activeConfig{
+		Config:    &config.Config{ArtifactStore: artifactstore.LocalStoreName, MaxInputFileSizeMB: config.DefaultMaxInputFileSizeMB},
+		artifacts: store,
+	})
+	return p, api, store
+}
+
 func TestServeHTTP(t *testing.T) {
 	assert := assert.New(t)
 	plugin := Plugin{}
@@ -27,3 +53,100 @@ func TestServeHTTP(t *testing.T) {
 
 	assert.Equal("Hello, world!", bodyString)
 }
+
+func TestGetConversionStatus(t *testing.T) {
+	setup := func() (*Plugin, *plugintest.API) {
+		p, api, _ := newTestPlugin(t)
+		api.On("GetFileInfo", "file-id").Return(&model.FileInfo{Id: "file-id", PostId: "post-id"}, nil)
+		api.On("GetPost", "post-id").Return(&model.Post{Id: "post-id", ChannelId: "channel-id"}, nil)
+		return p, api
+	}
+	request := func(p *Plugin) *http.Response {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/conversions/file-id", nil)
+		r.Header.Set("Mattermost-User-ID", "user-id")
+		p.ServeHTTP(nil, w, r)
+		return w.Result()
+	}
+
+	t.Run("without channel access", func(t *testing.T) {
+		p, api := setup()
+		api.On("HasPermissionToChannel", "user-id", "channel-id", model.PermissionReadChannel).Return(false)
+
+		result := request(p)
+		defer result.Body.Close()
+		assert.Equal(t, http.StatusForbidden, result.StatusCode)
+	})
+
+	t.Run("with channel access", func(t *testing.T) {
+		p, api := setup()
+		api.On("HasPermissionToChannel", "user-id", "channel-id", model.PermissionReadChannel).Return(true)
+		stored, _ := json.Marshal(&kvstore.ConversionStatus{FileID: "file-id", PostID: "post-id", State: kvstore.ConversionStateSucceeded})
+		api.On("KVGet", "conversion-file-id").Return(stored, nil)
+
+		result := request(p)
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode)
+
+		var status kvstore.ConversionStatus
+		require.NoError(t, json.NewDecoder(result.Body).Decode(&status))
+		assert.Equal(t, kvstore.ConversionStateSucceeded, status.State)
+	})
+}
+
+func TestFileReadPermissionRequired(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		fileInfo   *model.FileInfo
+		canRead    bool
+		expected   int
+		expectBody bool
+	}{
+		{
+			name:     "attached to a channel the user cannot read",
+			fileInfo: &model.FileInfo{Id: "file-id", PostId: "post-id", CreatorId: "other-user"},
+			canRead:  false,
+			expected: http.StatusForbidden,
+		},
+		{
+			name:       "attached to a channel the user can read",
+			fileInfo:   &model.FileInfo{Id: "file-id", PostId: "post-id", CreatorId: "other-user"},
+			canRead:    true,
+			expected:   http.StatusOK,
+			expectBody: true,
+		},
+		{
+			name:     "unattached file uploaded by someone else",
+			fileInfo: &model.FileInfo{Id: "file-id", CreatorId: "other-user"},
+			expected: http.StatusForbidden,
+		},
+		{
+			name:       "unattached file uploaded by the user",
+			fileInfo:   &model.FileInfo{Id: "file-id", CreatorId: "user-id"},
+			expected:   http.StatusOK,
+			expectBody: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, api, _ := newTestPlugin(t)
+			api.On("GetFileInfo", "file-id").Return(tc.fileInfo, nil)
+			api.On("GetPost", "post-id").Return(&model.Post{Id: "post-id", ChannelId: "channel-id"}, nil)
+			api.On("HasPermissionToChannel", "user-id", "channel-id", model.PermissionReadChannel).Return(tc.canRead)
+			api.On("GetFile", "file-id").Return([]byte("content"), nil)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/fileinfo?fileID=file-id", nil)
+			r.Header.Set("Mattermost-User-ID", "user-id")
+			p.ServeHTTP(nil, w, r)
+
+			result := w.Result()
+			defer result.Body.Close()
+			assert.Equal(t, tc.expected, result.StatusCode)
+			if tc.expectBody {
+				api.AssertCalled(t, "GetFile", "file-id")
+			} else {
+				api.AssertNotCalled(t, "GetFile", "file-id")
+			}
+		})
+	}
+}
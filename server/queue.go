@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/pkg/errors"
+
+	"github.com/jyoonje/collabview_plugin/server/config"
+	"github.com/jyoonje/collabview_plugin/server/fileconverter"
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+// startWorkers launches the bounded pool that processes queued conversion jobs.
+func (p *Plugin) startWorkers() *workerPool {
+	cfg := p.snapshot()
+	pool := newWorkerPool(cfg.MaxConcurrency, cfg.QueueDepth, p.runConversionJob)
+	p.pool.Store(pool)
+	p.API.LogInfo("변환 작업 풀 시작", "workers", cfg.MaxConcurrency, "queueDepth", cfg.QueueDepth)
+	return pool
+}
+
+// shutdownWorkers cancels the in-flight conversions and waits for them to wind down.
+// Interrupted and queued jobs stay pending in the KV store and are resumed on the next activation.
+func (p *Plugin) shutdownWorkers() {
+	if pool := p.pool.Swap(nil); pool != nil {
+		pool.close()
+	}
+}
+
+// submitJob dispatches a persisted job without blocking. While the plugin is stopping there is
+// no pool; the job then stays pending until the next activation.
+func (p *Plugin) submitJob(job *kvstore.Job) {
+	pool := p.pool.Load()
+	if pool == nil {
+		return
+	}
+	if err := pool.trySubmit(job.ID); err != nil {
+		// Do not block the caller; an overflowing job waits out a backoff instead.
+		p.API.LogWarn("변환 대기열 초과로 작업 지연", "jobID", job.ID, "fileID", job.FileID, "reason", err.Error())
+		p.scheduleRetry(p.snapshot(), job, err)
+	}
+}
+
+// enqueueConversion persists a pending conversion job for the post's file and dispatches it.
+// A file that already has a job waiting or running gets that job back instead of a second one.
+// Every node of a cluster runs the post hooks, so the check and the write hold a cluster-wide
+// lock on the file.
+func (p *Plugin) enqueueConversion(post *model.Post, fileID string) (*kvstore.Job, error) {
+	mutex, err := cluster.NewMutex(p.API, "enqueue-"+fileID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the file's enqueue lock")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if job, err := p.activeJob(fileID); err != nil || job != nil {
+		return job, err
+	}
+
+	now := model.GetMillis()
+	job := &kvstore.Job{
+		ID:        model.NewId(),
+		PostID:    post.Id,
+		ChannelID: post.ChannelId,
+		FileID:    fileID,
+		State:     kvstore.JobStatePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := p.kvstore.SaveJob(job); err != nil {
+		return nil, err
+	}
+	p.saveConversionStatus(newConversionStatus(job, kvstore.ConversionStateQueued))
+
+	p.submitJob(job)
+	return job, nil
+}
+
+// activeJob returns the unfinished job converting the file, if any.
+func (p *Plugin) activeJob(fileID string) (*kvstore.Job, error) {
+	status, err := p.kvstore.GetConversionStatus(fileID)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil || (status.State != kvstore.ConversionStateQueued && status.State != kvstore.ConversionStateRunning) {
+		return nil, nil
+	}
+
+	job, err := p.kvstore.GetJob(status.JobID)
+	if err != nil || job == nil || job.IsFinished() {
+		return nil, err
+	}
+	return job, nil
+}
+
+// resumePendingJobs re-dispatches every job that had not finished when the plugin last stopped.
+// Resumed jobs wait for room in the queue instead of being rejected, so call it from a goroutine.
+// A job still marked running is left as is: it may be running on another node, and only the run
+// holding its lock can tell that it was interrupted.
+func (p *Plugin) resumePendingJobs(pool *workerPool) error {
+	jobs, err := p.kvstore.ListJobs()
+	if err != nil {
+		return err
+	}
+
+	resumed := 0
+	for _, job := range jobs {
+		if job.IsFinished() {
+			continue
+		}
+		if wait := time.Until(time.UnixMilli(job.NextAttemptAt)); job.NextAttemptAt > 0 && wait > 0 {
+			pool.submitAfter(job.ID, wait)
+		} else if err := pool.submit(job.ID); err != nil {
+			// The pool is closing; the job stays pending for the next activation.
+			break
+		}
+		resumed++
+	}
+
+	if resumed > 0 {
+		p.API.LogInfo("미완료 변환 작업 재개", "count", resumed)
+	}
+	return nil
+}
+
+// runConversionJob loads the job, converts its file and records the outcome. The whole run uses
+// the configuration snapshot taken when it starts, even if the settings change meanwhile.
+func (p *Plugin) runConversionJob(ctx context.Context, jobID string) {
+	cfg := p.snapshot()
+	if cfg == nil {
+		return
+	}
+
+	// Every node resumes the pending jobs on activation; the mutex keeps them from converting
+	// the same file at once. The job is loaded once it is held, as another node may have run it.
+	mutex, err := cluster.NewMutex(p.API, "job-"+jobID)
+	if err != nil {
+		p.API.LogError("변환 작업 잠금 생성 실패", "jobID", jobID, "error", err.Error())
+		return
+	}
+	if err := mutex.LockWithContext(ctx); err != nil {
+		return
+	}
+	defer mutex.Unlock()
+
+	job, err := p.kvstore.GetJob(jobID)
+	if err != nil {
+		p.API.LogError("변환 작업 조회 실패", "jobID", jobID, "error", err.Error())
+		return
+	}
+	if job == nil || job.IsFinished() {
+		return
+	}
+	if wait := time.Until(time.UnixMilli(job.NextAttemptAt)); job.NextAttemptAt > 0 && wait > 0 {
+		// Another node failed the job meanwhile and scheduled its retry.
+		if pool := p.pool.Load(); pool != nil {
+			pool.submitAfter(job.ID, wait)
+		}
+		return
+	}
+
+	job.State = kvstore.JobStateRunning
+	job.Attempts++
+	job.NextAttemptAt = 0
+	job.UpdatedAt = model.GetMillis()
+	if err := p.kvstore.SaveJob(job); err != nil {
+		p.API.LogError("변환 작업 상태 저장 실패", "jobID", job.ID, "error", err.Error())
+		return
+	}
+	p.saveConversionStatus(newConversionStatus(job, kvstore.ConversionStateRunning))
+
+	convertCtx, cancel := context.WithTimeout(ctx, cfg.Timeout())
+	defer cancel()
+
+	started := time.Now()
+	result, err := p.convertFile(convertCtx, cfg, job)
+	if err != nil {
+		if ctx.Err() != nil {
+			// The plugin is shutting down; leave the job for the next activation without using up an attempt.
+			p.API.LogInfo("플러그인 종료로 파일 변환 중단", "jobID", job.ID, "fileID", job.FileID)
+			job.State = kvstore.JobStatePending
+			job.Attempts--
+			job.UpdatedAt = model.GetMillis()
+			if err := p.kvstore.SaveJob(job); err != nil {
+				p.API.LogError("변환 작업 상태 저장 실패", "jobID", job.ID, "error", err.Error())
+			}
+			p.saveConversionStatus(newConversionStatus(job, kvstore.ConversionStateQueued))
+			return
+		}
+		if errors.Is(err, errFileDetached) {
+			p.cancelJob(job, err)
+			return
+		}
+		p.API.LogError("파일 변환 실패", "jobID", job.ID, "fileID", job.FileID, "attempt", job.Attempts, "error", err.Error())
+		if isPermanent(err) || job.Attempts >= cfg.MaxAttempts {
+			p.deadLetterJob(job, err)
+		} else {
+			p.scheduleRetry(cfg, job, err)
+		}
+		return
+	}
+
+	job.State = kvstore.JobStateSucceeded
+	job.LastError = ""
+	job.UpdatedAt = model.GetMillis()
+	if err := p.kvstore.SaveJob(job); err != nil {
+		p.API.LogError("변환 작업 상태 저장 실패", "jobID", job.ID, "error", err.Error())
+	}
+
+	status := newConversionStatus(job, kvstore.ConversionStateSucceeded)
+	status.Converter = result.Converter
+	status.ArtifactKey = result.ArtifactKey
+	status.Format = result.Format
+	status.CacheHit = result.CacheHit
+	status.DurationMs = time.Since(started).Milliseconds()
+	p.saveConversionStatus(status)
+}
+
+// scheduleRetry puts the job back to pending and resubmits it once its backoff has elapsed.
+func (p *Plugin) scheduleRetry(cfg *activeConfig, job *kvstore.Job, cause error) {
+	delay := retryDelay(job.Attempts, cfg.RetryBaseDelay(), cfg.RetryMaxDelay())
+
+	job.State = kvstore.JobStatePending
+	job.LastError = cause.Error()
+	job.NextAttemptAt = time.Now().Add(delay).UnixMilli()
+	job.UpdatedAt = model.GetMillis()
+	if err := p.kvstore.SaveJob(job); err != nil {
+		p.API.LogError("변환 작업 상태 저장 실패", "jobID", job.ID, "error", err.Error())
+		return
+	}
+
+	status := newConversionStatus(job, kvstore.ConversionStateQueued)
+	status.Error = job.LastError
+	p.saveConversionStatus(status)
+
+	p.API.LogInfo("파일 변환 재시도 예약", "jobID", job.ID, "fileID", job.FileID, "delay", delay.String())
+	if pool := p.pool.Load(); pool != nil {
+		pool.submitAfter(job.ID, delay)
+	}
+}
+
+// deadLetterJob marks the job failed and adds it to the dead-letter list for admins to inspect.
+func (p *Plugin) deadLetterJob(job *kvstore.Job, cause error) {
+	job.State = kvstore.JobStateFailed
+	job.LastError = cause.Error()
+	job.UpdatedAt = model.GetMillis()
+	if err := p.kvstore.SaveJob(job); err != nil {
+		p.API.LogError("변환 작업 상태 저장 실패", "jobID", job.ID, "error", err.Error())
+	}
+
+	status := newConversionStatus(job, kvstore.ConversionStateFailed)
+	status.Error = job.LastError
+	p.saveConversionStatus(status)
+
+	entry := &kvstore.DeadLetter{
+		JobID:     job.ID,
+		PostID:    job.PostID,
+		ChannelID: job.ChannelID,
+		FileID:    job.FileID,
+		Attempts:  job.Attempts,
+		Reason:    cause.Error(),
+		FailedAt:  job.UpdatedAt,
+	}
+	if err := p.kvstore.AddDeadLetter(entry); err != nil {
+		p.API.LogError("실패 작업 목록 저장 실패", "jobID", job.ID, "error", err.Error())
+		return
+	}
+	p.API.LogWarn("파일 변환 최종 실패", "jobID", job.ID, "fileID", job.FileID, "attempts", job.Attempts, "permanent", isPermanent(cause))
+}
+
+// redriveJob takes a dead-lettered job off the list and queues it again with a fresh attempt budget.
+func (p *Plugin) redriveJob(jobID string) (*kvstore.Job, error) {
+	entry, err := p.kvstore.GetDeadLetter(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	job, err := p.kvstore.GetJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		// The job record was removed; rebuild it from the dead-letter entry.
+		job = &kvstore.Job{
+			ID:        entry.JobID,
+			PostID:    entry.PostID,
+			ChannelID: entry.ChannelID,
+			FileID:    entry.FileID,
+			CreatedAt: model.GetMillis(),
+		}
+	}
+
+	job.State = kvstore.JobStatePending
+	job.Attempts = 0
+	job.NextAttemptAt = 0
+	job.UpdatedAt = model.GetMillis()
+	if err := p.kvstore.SaveJob(job); err != nil {
+		return nil, err
+	}
+	if err := p.kvstore.DeleteDeadLetter(jobID); err != nil {
+		return nil, err
+	}
+	p.saveConversionStatus(newConversionStatus(job, kvstore.ConversionStateQueued))
+
+	p.submitJob(job)
+	return job, nil
+}
+
+// errConversionInProgress is returned when a retry is requested for a file being converted.
+var errConversionInProgress = errors.New("the file is already being converted")
+
+// RetryConversion implements command.ConversionService. A dead-lettered file is redriven; any
+// other file is converted from scratch, its current artifact being removed first.
+func (p *Plugin) RetryConversion(fileID string) (*kvstore.Job, error) {
+	cfg := p.snapshot()
+	if cfg == nil {
+		return nil, errors.New("plugin is not active")
+	}
+
+	status, err := p.kvstore.GetConversionStatus(fileID)
+	if err != nil {
+		return nil, err
+	}
+	if status != nil {
+		switch status.State {
+		case kvstore.ConversionStateQueued, kvstore.ConversionStateRunning:
+			job, err := p.activeJob(fileID)
+			if err != nil {
+				return nil, err
+			}
+			if job != nil {
+				return nil, errConversionInProgress
+			}
+		case kvstore.ConversionStateFailed:
+			if job, err := p.redriveJob(status.JobID); err != nil || job != nil {
+				return job, err
+			}
+		case kvstore.ConversionStateSucceeded:
+			// Otherwise the conversion cache would hand out the same artifact again.
+			if _, err := p.removeFileArtifacts(context.Background(), cfg, fileID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fileInfo, appErr := p.API.GetFileInfo(fileID)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get file info %s", fileID)
+	}
+	if fileInfo.PostId == "" {
+		return nil, errors.New("the file is not attached to a post")
+	}
+	post, appErr := p.API.GetPost(fileInfo.PostId)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get post %s", fileInfo.PostId)
+	}
+
+	p.API.LogInfo("파일 변환 재시도 요청", "fileID", fileID, "postID", post.Id)
+	return p.enqueueConversion(post, fileID)
+}
+
+// convertFile converts a single attachment and publishes the resulting artifact to the artifact
+// store, returning the converter that handled it, the key the artifact was published under and
+// its format.
+func (p *Plugin) convertFile(ctx context.Context, cfg *activeConfig, job *kvstore.Job) (*conversionResult, error) {
+	postID, fileID := job.PostID, job.FileID
+
+	fileInfo, appErr := p.API.GetFileInfo(fileID)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return nil, permanent(errors.Wrap(appErr, "파일 정보 조회 실패"))
+		}
+		return nil, errors.Wrap(appErr, "파일 정보 조회 실패")
+	}
+	if fileInfo.DeleteAt != 0 {
+		// The file was removed from its post after the job was queued.
+		return nil, errors.Wrapf(errFileDetached, "삭제된 파일: %s", fileID)
+	}
+
+	p.API.LogInfo("첨부된 파일 정보", "fileID", fileInfo.Id, "이름", fileInfo.Name, "저장 위치", fileInfo.Path)
+
+	converter, err := cfg.converters.Route(fileInfo.Name, fileInfo.MimeType)
+	if err != nil {
+		return nil, permanent(err)
+	}
+
+	p.publishConversionProgress(job, progressStageConverting)
+
+	filePath, cleanup, err := p.stageInput(cfg, fileInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	ext := converter.OutputExtension(strings.ToLower(filepath.Ext(fileInfo.Name)))
+	artifact := &kvstore.Artifact{
+		FileID:           fileID,
+		PostID:           postID,
+		Key:              config.ArtifactKey(postID, fileID, fileInfo.Name, ext),
+		Name:             fileInfo.Name,
+		Format:           strings.TrimPrefix(ext, "."),
+		Converter:        converter.Name(),
+		ConverterVersion: converter.Version(),
+	}
+	if artifact.ConverterVersion != "" {
+		if artifact.ContentHash, err = hashFile(filePath); err != nil {
+			return nil, errors.Wrap(err, "입력 파일 해시 계산 실패")
+		}
+		if entry := p.reuseCachedArtifact(ctx, cfg, artifact); entry != nil {
+			artifact.Size = entry.Size
+			artifact.PublishedAt = model.GetMillis()
+			if err := p.recordPublishedArtifact(ctx, cfg, artifact); err != nil {
+				return nil, err
+			}
+			return &conversionResult{Converter: converter.Name(), ArtifactKey: artifact.Key, Format: artifact.Format, CacheHit: true}, nil
+		}
+	}
+
+	sourceFile := cfg.ConvertedFilePath(fileID, fileInfo.Name, ext)
+	if err := converter.Convert(ctx, filePath, sourceFile); err != nil {
+		if errors.Is(err, fileconverter.ErrSkipped) {
+			p.API.LogInfo("변환 대상이 아닌 파일", "fileID", fileID, "converter", converter.Name())
+			return &conversionResult{Converter: converter.Name()}, nil
+		}
+		var gotenbergErr *fileconverter.GotenbergError
+		if errors.As(err, &gotenbergErr) && !gotenbergErr.Temporary() {
+			return nil, permanent(err)
+		}
+		return nil, err
+	}
+
+	p.API.LogInfo("파일 변환 성공 및 저장 완료", "fileID", fileID, "converter", converter.Name())
+
+	p.publishConversionProgress(job, progressStagePublishing)
+
+	if artifact.Size, err = p.publishArtifact(ctx, cfg, sourceFile, artifact.Key); err != nil {
+		return nil, err
+	}
+	artifact.PublishedAt = model.GetMillis()
+	if err := p.recordPublishedArtifact(ctx, cfg, artifact); err != nil {
+		return nil, err
+	}
+	p.cacheArtifact(artifact)
+	return &conversionResult{Converter: converter.Name(), ArtifactKey: artifact.Key, Format: artifact.Format}, nil
+}
+
+// errFileDetached is returned when the file was deleted, detached by an edit of its post, or its
+// post was deleted, while the file waited for or went through its conversion.
+var errFileDetached = errors.New("the file is no longer attached to its post")
+
+// recordPublishedArtifact records the artifact just published under its key, unless the file
+// left its post meanwhile. The cleanup of a deleted post does not wait for the conversions in
+// flight, so their artifact is withdrawn here instead of outliving the cleanup.
+func (p *Plugin) recordPublishedArtifact(ctx context.Context, cfg *activeConfig, artifact *kvstore.Artifact) error {
+	if err := p.checkAttached(artifact.PostID, artifact.FileID); err != nil {
+		if errors.Is(err, errFileDetached) {
+			if deleteErr := cfg.artifacts.Delete(ctx, artifact.Key); deleteErr != nil {
+				p.API.LogWarn("분리된 파일의 .esob 파일 삭제 실패", "fileID", artifact.FileID, "key", artifact.Key, "error", deleteErr.Error())
+			}
+		}
+		return err
+	}
+	return p.recordArtifact(ctx, cfg, artifact)
+}
+
+// checkAttached returns errFileDetached unless the post and the file still exist and the post
+// still lists the file among its attachments.
+func (p *Plugin) checkAttached(postID, fileID string) error {
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return errors.Wrapf(errFileDetached, "삭제된 게시글: %s", postID)
+		}
+		return errors.Wrap(appErr, "게시글 조회 실패")
+	}
+	if post.DeleteAt != 0 {
+		return errors.Wrapf(errFileDetached, "삭제된 게시글: %s", postID)
+	}
+	if !slices.Contains(post.FileIds, fileID) {
+		// An edit detached the file; its removal task may already have run.
+		return errors.Wrapf(errFileDetached, "게시글에서 분리된 파일: %s", fileID)
+	}
+
+	fileInfo, appErr := p.API.GetFileInfo(fileID)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return errors.Wrapf(errFileDetached, "삭제된 파일: %s", fileID)
+		}
+		return errors.Wrap(appErr, "파일 정보 조회 실패")
+	}
+	if fileInfo.DeleteAt != 0 {
+		return errors.Wrapf(errFileDetached, "삭제된 파일: %s", fileID)
+	}
+	return nil
+}
+
+// cancelJob drops a job whose file left its post. Its status record is removed rather than
+// marked failed, as the cleanup of the post already removed, or is about to remove, the rest.
+func (p *Plugin) cancelJob(job *kvstore.Job, cause error) {
+	job.State = kvstore.JobStateCanceled
+	job.LastError = cause.Error()
+	job.UpdatedAt = model.GetMillis()
+	if err := p.kvstore.SaveJob(job); err != nil {
+		p.API.LogError("변환 작업 상태 저장 실패", "jobID", job.ID, "error", err.Error())
+	}
+	if err := p.kvstore.DeleteConversionStatus(job.FileID); err != nil {
+		p.API.LogError("변환 상태 삭제 실패", "fileID", job.FileID, "error", err.Error())
+	}
+	p.API.LogInfo("분리된 파일의 변환 작업 취소", "jobID", job.ID, "fileID", job.FileID, "reason", cause.Error())
+}
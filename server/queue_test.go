@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jyoonje/collabview_plugin/server/config"
+	"github.com/jyoonje/collabview_plugin/server/fileconverter"
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+// kvMemory backs the KV calls of the API mock with a map, so that records can be followed across
+// calls and across plugin instances sharing the map. Atomic writes, e.g. those of cluster
+// mutexes, only succeed when the stored value is the expected one.
+func kvMemory(api *plugintest.API, kv map[string][]byte) {
+	api.On("KVGet", mock.Anything).Return(func(key string) []byte {
+		return kv[key]
+	}, nil)
+	api.On("KVSetWithOptions", mock.Anything, mock.Anything, mock.Anything).Return(func(key string, value []byte, options model.PluginKVSetOptions) bool {
+		if current, ok := kv[key]; options.Atomic && (ok != (options.OldValue != nil) || !bytes.Equal(current, options.OldValue)) {
+			return false
+		}
+		if value == nil {
+			delete(kv, key)
+		} else {
+			kv[key] = value
+		}
+		return true
+	}, nil)
+	api.On("KVList", mock.Anything, mock.Anything).Return(func(page, perPage int) []string {
+		keys := make([]string, 0, len(kv))
+		for key := range kv {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if page*perPage >= len(keys) {
+			return []string{}
+		}
+		return keys[page*perPage : min((page+1)*perPage, len(keys))]
+	}, nil)
+}
+
+func storedJob(t *testing.T, kv map[string][]byte, jobID string) *kvstore.Job {
+	t.Helper()
+	var job kvstore.Job
+	require.NoError(t, json.Unmarshal(kv["job-"+jobID], &job))
+	return &job
+}
+
+func TestEnqueueConversionResumesAfterRestart(t *testing.T) {
+	kv := map[string][]byte{}
+	post := &model.Post{Id: "post", ChannelId: "channel"}
+
+	p, api, _ := newTestPlugin(t)
+	kvMemory(api, kv)
+	api.On("PublishWebSocketEvent", mock.Anything, mock.Anything, mock.Anything)
+
+	// Without workers the job stays in the queue, as it would when the plugin stops.
+	p.pool.Store(newWorkerPool(0, 10, func(context.Context, string) {}))
+	job, err := p.enqueueConversion(post, "file")
+	require.NoError(t, err)
+	p.shutdownWorkers()
+
+	assert.Equal(t, kvstore.JobStatePending, storedJob(t, kv, job.ID).State)
+	var status kvstore.ConversionStatus
+	require.NoError(t, json.Unmarshal(kv["conversion-file"], &status))
+	assert.Equal(t, kvstore.ConversionStateQueued, status.State)
+	assert.Equal(t, job.ID, status.JobID)
+
+	// A conversion interrupted mid-run, one waiting out its backoff and one already finished.
+	interrupted := &kvstore.Job{ID: "interrupted", PostID: "post", FileID: "other", State: kvstore.JobStateRunning, Attempts: 1}
+	backingOff := &kvstore.Job{ID: "backoff", PostID: "post", FileID: "third", State: kvstore.JobStatePending, NextAttemptAt: time.Now().Add(time.Hour).UnixMilli()}
+	finished := &kvstore.Job{ID: "finished", PostID: "post", FileID: "fourth", State: kvstore.JobStateSucceeded}
+	for _, stored := range []*kvstore.Job{interrupted, backingOff, finished} {
+		kv["job-"+stored.ID], _ = json.Marshal(stored)
+	}
+
+	restarted, api, _ := newTestPlugin(t)
+	kvMemory(api, kv)
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	dispatched := make(chan string, 10)
+	pool := newWorkerPool(1, 10, func(_ context.Context, jobID string) { dispatched <- jobID })
+	defer pool.close()
+	require.NoError(t, restarted.resumePendingJobs(pool))
+
+	var resumed []string
+	for len(resumed) < 2 {
+		select {
+		case jobID := <-dispatched:
+			resumed = append(resumed, jobID)
+		case <-time.After(time.Second):
+			require.FailNow(t, "pending jobs were not dispatched", "resumed: %v", resumed)
+		}
+	}
+	assert.ElementsMatch(t, []string{job.ID, "interrupted"}, resumed)
+	assert.Equal(t, kvstore.JobStateRunning, storedJob(t, kv, "interrupted").State, "only the run holding the job's lock tells an interrupted run from one on another node")
+	assert.Equal(t, 1, storedJob(t, kv, "interrupted").Attempts)
+
+	pool.timersLock.Lock()
+	_, waiting := pool.timers["backoff"]
+	pool.timersLock.Unlock()
+	assert.True(t, waiting, "a job waiting out its backoff is submitted when it elapses")
+}
+
+func TestEnqueueConversionDeduplicates(t *testing.T) {
+	kv := map[string][]byte{}
+	post := &model.Post{Id: "post", ChannelId: "channel"}
+
+	p, api, _ := newTestPlugin(t)
+	kvMemory(api, kv)
+	api.On("PublishWebSocketEvent", mock.Anything, mock.Anything, mock.Anything)
+	p.pool.Store(newWorkerPool(0, 10, func(context.Context, string) {}))
+	defer p.shutdownWorkers()
+
+	first, err := p.enqueueConversion(post, "file")
+	require.NoError(t, err)
+	second, err := p.enqueueConversion(post, "file")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID, "a file waiting for conversion is not queued twice")
+
+	countJobs := func() int {
+		count := 0
+		for key := range kv {
+			if strings.HasPrefix(key, "job-") {
+				count++
+			}
+		}
+		return count
+	}
+	assert.Equal(t, 1, countJobs())
+
+	// Once the job finished, the file can be queued again.
+	done := storedJob(t, kv, first.ID)
+	done.State = kvstore.JobStateSucceeded
+	kv["job-"+done.ID], _ = json.Marshal(done)
+
+	third, err := p.enqueueConversion(post, "file")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, third.ID)
+	assert.Equal(t, 2, countJobs())
+}
+
+func TestRunConversionJobDropsDetachedFile(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		post *model.Post
+	}{
+		// The post is deleted while its file is being converted.
+		{name: "deleted post", post: &model.Post{Id: "post", ChannelId: "channel", FileIds: []string{"file"}, DeleteAt: model.GetMillis()}},
+		// An edit detaches the file while it is being converted.
+		{name: "detached by an edit", post: &model.Post{Id: "post", ChannelId: "channel", FileIds: []string{"other"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testRunConversionJobDropsDetachedFile(t, tc.post)
+		})
+	}
+}
+
+func testRunConversionJobDropsDetachedFile(t *testing.T, post *model.Post) {
+	kv := map[string][]byte{}
+	p, api, store := newTestPlugin(t)
+	cfg := p.snapshot()
+	cfg.MattermostOutput = t.TempDir()
+	cfg.MaxAttempts = config.DefaultMaxAttempts
+	cfg.TimeoutSeconds = config.DefaultTimeoutSeconds
+	converters, err := fileconverter.NewRegistry("*=passthrough", fileconverter.PassthroughConverter{})
+	require.NoError(t, err)
+	cfg.converters = converters
+
+	kvMemory(api, kv)
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("PublishWebSocketEvent", mock.Anything, mock.Anything, mock.Anything)
+	api.On("GetFileInfo", "file").Return(&model.FileInfo{Id: "file", PostId: "post", Name: "plan.png", MimeType: "image/png", Size: 7}, nil)
+	api.On("GetFile", "file").Return([]byte("drawing"), nil)
+	api.On("GetPost", "post").Return(post, nil)
+
+	job := &kvstore.Job{ID: "job", PostID: "post", ChannelID: "channel", FileID: "file", State: kvstore.JobStatePending}
+	require.NoError(t, p.kvstore.SaveJob(job))
+
+	p.runConversionJob(context.Background(), job.ID)
+
+	assert.Equal(t, kvstore.JobStateCanceled, storedJob(t, kv, job.ID).State)
+	assert.NotContains(t, kv, "conversion-file", "no status is left for the removed file")
+	assert.NotContains(t, kv, "artifact-file", "no manifest entry is recorded")
+	infos, err := store.List(context.Background(), "post/")
+	require.NoError(t, err)
+	assert.Empty(t, infos, "the published artifact is withdrawn")
+}
+
+func TestRunConversionJobHoldsClusterLock(t *testing.T) {
+	kv := map[string][]byte{}
+	p, api, _ := newTestPlugin(t)
+	kvMemory(api, kv)
+
+	job := &kvstore.Job{ID: "job", PostID: "post", FileID: "file", State: kvstore.JobStateRunning, Attempts: 1}
+	require.NoError(t, p.kvstore.SaveJob(job))
+
+	// Another node is converting the file.
+	kv["mutex_job-job"] = []byte{1}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	p.runConversionJob(ctx, job.ID)
+	assert.Equal(t, 1, storedJob(t, kv, job.ID).Attempts, "the job is left to the node holding its lock")
+
+	// Once it released the lock, the job turns out to be done.
+	delete(kv, "mutex_job-job")
+	job.State = kvstore.JobStateSucceeded
+	require.NoError(t, p.kvstore.SaveJob(job))
+	p.runConversionJob(context.Background(), job.ID)
+	assert.Equal(t, kvstore.JobStateSucceeded, storedJob(t, kv, job.ID).State)
+	assert.Equal(t, 1, storedJob(t, kv, job.ID).Attempts)
+	assert.NotContains(t, kv, "mutex_job-job", "the lock is released")
+}
+
+func TestScheduleRetryStartsAtBaseDelay(t *testing.T) {
+	kv := map[string][]byte{}
+	p, api, _ := newTestPlugin(t)
+	cfg := p.snapshot()
+	cfg.RetryBaseDelaySeconds = 10
+	cfg.RetryMaxDelaySeconds = 600
+	kvMemory(api, kv)
+	api.On("PublishWebSocketEvent", mock.Anything, mock.Anything, mock.Anything)
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	for _, tc := range []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: 10 * time.Second},
+		{attempts: 2, expected: 20 * time.Second},
+	} {
+		// Attempts counts the run that just failed.
+		job := &kvstore.Job{ID: "job", PostID: "post", ChannelID: "channel", FileID: "file", State: kvstore.JobStateRunning, Attempts: tc.attempts}
+		p.scheduleRetry(cfg, job, errors.New("converter unavailable"))
+
+		wait := time.Until(time.UnixMilli(storedJob(t, kv, job.ID).NextAttemptAt))
+		assert.LessOrEqual(t, wait, tc.expected, "after %d failed attempts", tc.attempts)
+		assert.Greater(t, wait, tc.expected/2-time.Second, "after %d failed attempts", tc.attempts)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+
+	"github.com/jyoonje/collabview_plugin/server/store/artifactstore"
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+// reconcileGracePeriod leaves the posts created or edited just now to the event hooks, which
+// may still be enqueueing their files.
+const reconcileGracePeriod = 5 * time.Minute
+
+// artifactProblem tells why reconciliation converts a file again.
+type artifactProblem string
+
+const (
+	// artifactMissing means the file was never converted, its job was lost or its artifact is gone.
+	artifactMissing artifactProblem = "missing"
+	// artifactCorrupt means the stored artifact does not match the manifest.
+	artifactCorrupt artifactProblem = "corrupt"
+)
+
+// reconcileReport summarizes a reconciliation pass.
+type reconcileReport struct {
+	StartedAt  int64    `json:"started_at"`
+	FinishedAt int64    `json:"finished_at"`
+	Channels   int      `json:"channels"`
+	Posts      int      `json:"posts"`
+	Files      int      `json:"files"`
+	Missing    int      `json:"missing"`
+	Corrupt    int      `json:"corrupt"`
+	Enqueued   int      `json:"enqueued"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+func (r *reconcileReport) fail(p *Plugin, step string, err error) {
+	p.API.LogError("변환 누락 점검 실패", "step", step, "error", err.Error())
+	r.Errors = append(r.Errors, step+": "+err.Error())
+}
+
+// reconcile walks the recent posts of the configured channels and converts again the
+// attachments left without a usable artifact, e.g. because the plugin was disabled or crashed
+// while they were posted.
+func (p *Plugin) reconcile(ctx context.Context, cfg *activeConfig, now time.Time) *reconcileReport {
+	report := &reconcileReport{StartedAt: now.UnixMilli()}
+	since := now.Add(-cfg.ReconcileLookback()).UnixMilli()
+	settled := now.Add(-reconcileGracePeriod).UnixMilli()
+
+	for _, channelID := range cfg.ReconcileChannels() {
+		posts, appErr := p.API.GetPostsSince(channelID, since)
+		if appErr != nil {
+			report.fail(p, "get posts "+channelID, appErr)
+			continue
+		}
+		report.Channels++
+
+		for _, postID := range posts.Order {
+			post := posts.Posts[postID]
+			if post == nil || post.DeleteAt != 0 || len(post.FileIds) == 0 || post.UpdateAt > settled {
+				continue
+			}
+			report.Posts++
+			for _, fileID := range post.FileIds {
+				report.Files++
+				p.reconcileFile(ctx, cfg, post, fileID, report)
+			}
+		}
+	}
+
+	report.FinishedAt = model.GetMillis()
+	return report
+}
+
+func (p *Plugin) logReconcileReport(report *reconcileReport) {
+	p.API.LogInfo("변환 누락 점검 완료",
+		"channels", report.Channels,
+		"posts", report.Posts,
+		"files", report.Files,
+		"missing", report.Missing,
+		"corrupt", report.Corrupt,
+		"enqueued", report.Enqueued,
+		"errors", len(report.Errors),
+	)
+}
+
+func (p *Plugin) reconcileFile(ctx context.Context, cfg *activeConfig, post *model.Post, fileID string, report *reconcileReport) {
+	problem, err := p.requeueFile(ctx, cfg, post, fileID)
+	switch problem {
+	case artifactMissing:
+		report.Missing++
+	case artifactCorrupt:
+		report.Corrupt++
+	}
+	if err != nil {
+		report.fail(p, "reconcile "+fileID, err)
+		return
+	}
+	if problem != "" {
+		report.Enqueued++
+	}
+}
+
+// requeueFile converts the file again if it has no usable artifact, and returns the problem
+// that was found.
+func (p *Plugin) requeueFile(ctx context.Context, cfg *activeConfig, post *model.Post, fileID string) (artifactProblem, error) {
+	problem, err := p.checkArtifact(ctx, cfg, fileID)
+	if err != nil || problem == "" {
+		return problem, err
+	}
+	if problem == artifactCorrupt {
+		// Remove the artifact first so that the cache cannot hand it out again.
+		if _, err := p.removeFileArtifacts(ctx, cfg, fileID); err != nil {
+			return problem, err
+		}
+	}
+
+	p.API.LogInfo("변환 누락 파일 재변환 등록", "postID", post.Id, "fileID", fileID, "problem", problem)
+	if _, err := p.enqueueConversion(post, fileID); err != nil {
+		return problem, err
+	}
+	return problem, nil
+}
+
+// ConvertPost implements command.ConversionService. Only the files without a usable artifact
+// are queued; it returns how many were.
+func (p *Plugin) ConvertPost(postID string) (int, error) {
+	cfg := p.snapshot()
+	if cfg == nil {
+		return 0, errors.New("plugin is not active")
+	}
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return 0, errors.Wrapf(appErr, "failed to get post %s", postID)
+	}
+
+	ctx := context.Background()
+	queued := 0
+	var failed error
+	for _, fileID := range post.FileIds {
+		problem, err := p.requeueFile(ctx, cfg, post, fileID)
+		if err != nil {
+			p.API.LogError("변환 작업 등록 실패", "postID", post.Id, "fileID", fileID, "error", err.Error())
+			failed = err
+			continue
+		}
+		if problem != "" {
+			queued++
+		}
+	}
+	return queued, failed
+}
+
+// checkArtifact compares a file's conversion record with its artifact. Files whose conversion
+// is in progress, failed for good or was skipped by their converter have no problem.
+func (p *Plugin) checkArtifact(ctx context.Context, cfg *activeConfig, fileID string) (artifactProblem, error) {
+	status, err := p.kvstore.GetConversionStatus(fileID)
+	if err != nil {
+		return "", err
+	}
+	if status == nil {
+		return artifactMissing, nil
+	}
+
+	switch status.State {
+	case kvstore.ConversionStateQueued, kvstore.ConversionStateRunning:
+		job, err := p.kvstore.GetJob(status.JobID)
+		if err != nil {
+			return "", err
+		}
+		if job == nil || job.IsFinished() {
+			return artifactMissing, nil
+		}
+		return "", nil
+	case kvstore.ConversionStateFailed:
+		// Dead-lettered files are redriven by an admin.
+		return "", nil
+	case kvstore.ConversionStateExpired:
+		// The artifact was removed on purpose.
+		return "", nil
+	}
+	if status.ArtifactKey == "" {
+		return "", nil
+	}
+
+	artifact, err := p.kvstore.GetArtifact(fileID)
+	if err != nil {
+		return "", err
+	}
+	if artifact == nil || artifact.Key != status.ArtifactKey {
+		return artifactMissing, nil
+	}
+
+	info, err := cfg.artifacts.Stat(ctx, artifact.Key)
+	if errors.Is(err, artifactstore.ErrNotFound) {
+		return artifactMissing, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.Size != artifact.Size {
+		return artifactCorrupt, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+func TestCheckArtifact(t *testing.T) {
+	ctx := context.Background()
+
+	succeeded := &kvstore.ConversionStatus{FileID: "file", JobID: "job", State: kvstore.ConversionStateSucceeded, ArtifactKey: "post/file/plan.esob"}
+	queued := &kvstore.ConversionStatus{FileID: "file", JobID: "job", State: kvstore.ConversionStateQueued}
+	manifest := &kvstore.Artifact{FileID: "file", PostID: "post", Key: "post/file/plan.esob", Size: 8}
+
+	for _, tc := range []struct {
+		name     string
+		status   *kvstore.ConversionStatus
+		job      *kvstore.Job
+		artifact *kvstore.Artifact
+		expected artifactProblem
+	}{
+		{
+			name:     "never converted",
+			expected: artifactMissing,
+		},
+		{
+			name:     "intact artifact",
+			status:   succeeded,
+			artifact: manifest,
+		},
+		{
+			name:     "size differs from the manifest",
+			status:   succeeded,
+			artifact: &kvstore.Artifact{FileID: "file", Key: "post/file/plan.esob", Size: 1024},
+			expected: artifactCorrupt,
+		},
+		{
+			name:     "artifact gone from the store",
+			status:   &kvstore.ConversionStatus{FileID: "file", State: kvstore.ConversionStateSucceeded, ArtifactKey: "post/file/gone.esob"},
+			artifact: &kvstore.Artifact{FileID: "file", Key: "post/file/gone.esob", Size: 8},
+			expected: artifactMissing,
+		},
+		{
+			name:     "no manifest entry",
+			status:   succeeded,
+			expected: artifactMissing,
+		},
+		{
+			name:   "conversion in progress",
+			status: queued,
+			job:    &kvstore.Job{ID: "job", FileID: "file", State: kvstore.JobStatePending},
+		},
+		{
+			name:     "job lost while queued",
+			status:   queued,
+			expected: artifactMissing,
+		},
+		{
+			name:   "dead-lettered",
+			status: &kvstore.ConversionStatus{FileID: "file", State: kvstore.ConversionStateFailed},
+		},
+		{
+			name:   "expired after the retention period",
+			status: &kvstore.ConversionStatus{FileID: "file", State: kvstore.ConversionStateExpired},
+		},
+		{
+			name:   "skipped by its converter",
+			status: &kvstore.ConversionStatus{FileID: "file", State: kvstore.ConversionStateSucceeded, Converter: "noop"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, api, store := newTestPlugin(t)
+			cfg := p.snapshot()
+			require.NoError(t, store.Put(ctx, "post/file/plan.esob", strings.NewReader("artifact"), 8))
+
+			// A nil record is stored as JSON null, which reads back as a missing one.
+			kvValue := func(v any) []byte {
+				data, err := json.Marshal(v)
+				require.NoError(t, err)
+				return data
+			}
+			api.On("KVGet", "conversion-file").Return(kvValue(tc.status), nil).Maybe()
+			api.On("KVGet", "job-job").Return(kvValue(tc.job), nil).Maybe()
+			api.On("KVGet", "artifact-file").Return(kvValue(tc.artifact), nil).Maybe()
+
+			problem, err := p.checkArtifact(ctx, cfg, "file")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, problem)
+		})
+	}
+}
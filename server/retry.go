@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// permanentError marks a conversion failure that retrying cannot fix, such as a deleted file.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent wraps err so the job is dead-lettered without further attempts.
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// isPermanent reports whether err, or any error it wraps, was marked permanent.
+// Unclassified errors are treated as transient.
+func isPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// retryDelay returns the backoff after the given number of failed attempts: base after the
+// first, doubling up to maxDelay, with jitter in the upper half so that a burst of failures
+// does not retry in lockstep.
+func retryDelay(attempt int, base, maxDelay time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	//nolint:gosec // jitter does not need a cryptographic source
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDelay(t *testing.T) {
+	base := 10 * time.Second
+	maxDelay := time.Minute
+
+	for _, tc := range []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{attempt: 1, expected: 10 * time.Second},
+		{attempt: 2, expected: 20 * time.Second},
+		{attempt: 3, expected: 40 * time.Second},
+		{attempt: 4, expected: time.Minute},
+		{attempt: 50, expected: time.Minute},
+	} {
+		t.Run(fmt.Sprintf("attempt %d", tc.attempt), func(t *testing.T) {
+			delay := retryDelay(tc.attempt, base, maxDelay)
+			assert.GreaterOrEqual(t, delay, tc.expected/2)
+			assert.LessOrEqual(t, delay, tc.expected)
+		})
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	assert := assert.New(t)
+
+	cause := errors.New("file not found")
+	assert.True(isPermanent(permanent(cause)))
+	assert.True(isPermanent(errors.Wrap(permanent(cause), "convert")))
+	assert.False(isPermanent(cause))
+	assert.False(isPermanent(errQueueFull))
+	assert.Nil(permanent(nil))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost/server/public/model"
+
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+)
+
+// conversionResult describes the artifact produced for a file.
+type conversionResult struct {
+	Converter string
+	// ArtifactKey is empty when the converter skipped the file.
+	ArtifactKey string
+	// Format is the artifact's file extension without the dot.
+	Format string
+	// CacheHit is set when an artifact converted from identical content was reused.
+	CacheHit bool
+}
+
+// newConversionStatus starts a status record for the job's file in the given state.
+func newConversionStatus(job *kvstore.Job, state kvstore.ConversionState) *kvstore.ConversionStatus {
+	return &kvstore.ConversionStatus{
+		FileID:    job.FileID,
+		PostID:    job.PostID,
+		ChannelID: job.ChannelID,
+		JobID:     job.ID,
+		State:     state,
+	}
+}
+
+// GetConversionStatus implements command.ConversionService.
+func (p *Plugin) GetConversionStatus(fileID string) (*kvstore.ConversionStatus, error) {
+	return p.kvstore.GetConversionStatus(fileID)
+}
+
+// saveConversionStatus stamps, persists and broadcasts a file's conversion status. Failing to
+// record the status must not fail the conversion itself, so errors are only logged.
+func (p *Plugin) saveConversionStatus(status *kvstore.ConversionStatus) {
+	status.UpdatedAt = model.GetMillis()
+	if err := p.kvstore.SaveConversionStatus(status); err != nil {
+		p.API.LogError("변환 상태 저장 실패", "fileID", status.FileID, "state", status.State, "error", err.Error())
+	}
+	p.publishConversionStatus(status)
+}
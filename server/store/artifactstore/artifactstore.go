@@ -0,0 +1,102 @@
+package artifactstore
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Store names accepted by the ArtifactStore setting.
+const (
+	LocalStoreName     = "local"
+	FileStoreName      = "filestore"
+	S3StoreName        = "s3"
+	DefaultStoreName   = LocalStoreName
+	defaultContentType = "application/octet-stream"
+)
+
+var (
+	// ErrNotFound is returned when no artifact is stored under the key.
+	ErrNotFound = errors.New("artifact not found")
+	// ErrInvalidKey is returned for keys that are empty, absolute or escape the store.
+	ErrInvalidKey = errors.New("invalid artifact key")
+)
+
+// Info describes a stored artifact.
+type Info struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// ArtifactStore keeps converted artifacts under opaque, slash-separated keys such as
+// "<postID>/<fileID>/<name>.esob". Implementations must be safe for concurrent use.
+type ArtifactStore interface {
+	// Put stores size bytes read from r under key, replacing any previous artifact.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get opens the artifact stored under key. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat describes the artifact stored under key, or returns ErrNotFound.
+	Stat(ctx context.Context, key string) (*Info, error)
+	// Delete removes the artifact stored under key. Deleting a missing artifact is not an error.
+	Delete(ctx context.Context, key string) error
+	// List describes every artifact whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]Info, error)
+}
+
+// Mover is implemented by stores that can take ownership of a local file more cheaply than by
+// reading it through Put.
+type Mover interface {
+	// Move publishes the file at path under key and removes the file.
+	Move(ctx context.Context, key, path string) error
+}
+
+// Copier is implemented by stores that can duplicate an artifact without downloading it.
+type Copier interface {
+	// Copy stores the artifact found under srcKey under dstKey as well.
+	Copy(ctx context.Context, srcKey, dstKey string) error
+}
+
+// Purger is implemented by stores that can leave unfinished writes behind, e.g. when the
+// server stops in the middle of a Put.
+type Purger interface {
+	// PurgeTemp removes the unfinished writes last modified before the given time and returns
+	// how many files and bytes were reclaimed.
+	PurgeTemp(ctx context.Context, before time.Time) (int, int64, error)
+}
+
+// Copy duplicates the artifact stored under srcKey to dstKey, natively when the store
+// supports it.
+func Copy(ctx context.Context, store ArtifactStore, srcKey, dstKey string) error {
+	if copier, ok := store.(Copier); ok {
+		return copier.Copy(ctx, srcKey, dstKey)
+	}
+
+	info, err := store.Stat(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	reader, err := store.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return store.Put(ctx, dstKey, reader, info.Size)
+}
+
+// CheckKey rejects keys that could address something outside of the store.
+func CheckKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key {
+		return errors.Wrap(ErrInvalidKey, key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." || segment == "." {
+			return errors.Wrap(ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package artifactstore
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// NewFileStore returns a store writing under prefix in the file storage Mattermost itself is
+// configured with, so that artifacts live next to the attachments they were converted from.
+// dataRoot overrides FileSettings.Directory with the local driver; the server's directory is
+// usually relative to its own working directory, which the plugin does not share.
+func NewFileStore(settings model.FileSettings, dataRoot, prefix string) (ArtifactStore, error) {
+	switch driver := model.SafeDereference(settings.DriverName); driver {
+	case model.ImageDriverLocal:
+		root := dataRoot
+		if root == "" {
+			root = model.SafeDereference(settings.Directory)
+		}
+		if !filepath.IsAbs(root) {
+			return nil, errors.Errorf("the Mattermost file directory %q is not absolute; set the Mattermost data directory", root)
+		}
+		return NewLocalStore(filepath.Join(root, filepath.FromSlash(prefix))), nil
+
+	case model.ImageDriverS3:
+		accessKeyID := model.SafeDereference(settings.AmazonS3AccessKeyId)
+		if accessKeyID == "" {
+			return nil, errors.New("the Mattermost file storage uses IAM credentials, which are not supported; use the s3 store with explicit keys")
+		}
+		scheme := "http"
+		if model.SafeDereference(settings.AmazonS3SSL) {
+			scheme = "https"
+		}
+		storePrefix := strings.TrimPrefix(path.Join(model.SafeDereference(settings.AmazonS3PathPrefix), prefix), "/") + "/"
+		return NewS3Store(S3Options{
+			Endpoint:        scheme + "://" + model.SafeDereference(settings.AmazonS3Endpoint),
+			Bucket:          model.SafeDereference(settings.AmazonS3Bucket),
+			Region:          model.SafeDereference(settings.AmazonS3Region),
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: model.SafeDereference(settings.AmazonS3SecretAccessKey),
+			Prefix:          storePrefix,
+		})
+
+	default:
+		return nil, errors.Errorf("unsupported Mattermost file driver %q", driver)
+	}
+}
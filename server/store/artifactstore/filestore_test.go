@@ -0,0 +1,47 @@
+package artifactstore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFileStore(t *testing.T) {
+	t.Run("local driver", func(t *testing.T) {
+		settings := model.FileSettings{DriverName: model.NewPointer(model.ImageDriverLocal), Directory: model.NewPointer("./data/")}
+
+		_, err := NewFileStore(settings, "", "plugins/collabview")
+		assert.Error(t, err, "a relative server directory cannot be resolved")
+
+		store, err := NewFileStore(settings, "/srv/mattermost/data", "plugins/collabview")
+		require.NoError(t, err)
+		require.IsType(t, &LocalStore{}, store)
+		assert.Equal(t, filepath.Join("/srv/mattermost/data", "plugins", "collabview"), store.(*LocalStore).Root())
+	})
+
+	t.Run("S3 driver", func(t *testing.T) {
+		settings := model.FileSettings{
+			DriverName:              model.NewPointer(model.ImageDriverS3),
+			AmazonS3Endpoint:        model.NewPointer("minio:9000"),
+			AmazonS3Bucket:          model.NewPointer("mattermost"),
+			AmazonS3PathPrefix:      model.NewPointer("team/"),
+			AmazonS3AccessKeyId:     model.NewPointer("key"),
+			AmazonS3SecretAccessKey: model.NewPointer("secret"),
+			AmazonS3SSL:             model.NewPointer(true),
+		}
+
+		store, err := NewFileStore(settings, "", "plugins/collabview")
+		require.NoError(t, err)
+		require.IsType(t, &S3Store{}, store)
+		s3 := store.(*S3Store)
+		assert.Equal(t, "https://minio:9000", s3.endpoint.String())
+		assert.Equal(t, "team/plugins/collabview/", s3.opts.Prefix)
+
+		settings.AmazonS3AccessKeyId = model.NewPointer("")
+		_, err = NewFileStore(settings, "", "plugins/collabview")
+		assert.Error(t, err, "IAM credentials are not supported")
+	})
+}
@@ -0,0 +1,327 @@
+package artifactstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tempSuffix marks files being written; a crash can leave them behind for the cleanup sweep.
+const tempSuffix = ".tmp-*"
+
+// rename is replaced in tests to simulate moves across filesystems.
+var rename = os.Rename
+
+// LocalStore keeps artifacts in a directory, one file per key.
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore returns a store rooted at the given directory.
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{root: root}
+}
+
+// Root returns the directory the artifacts are stored in.
+func (s *LocalStore) Root() string {
+	return s.root
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if err := CheckKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the artifact to a temporary file next to its destination, syncs it, checks what
+// landed on disk against what was read, and only then renames it into place. Readers never see a
+// partially written artifact, and nothing is left behind when publishing fails.
+func (s *LocalStore) Put(_ context.Context, key string, r io.Reader, size int64) error {
+	dest, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "failed to create artifact directory for %s", key)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+tempSuffix)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temporary file for artifact %s", key)
+	}
+	published := false
+	defer func() {
+		if !published {
+			tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	hash := sha256.New()
+	written, err := io.Copy(tmp, io.TeeReader(r, hash))
+	if err != nil {
+		return errors.Wrapf(err, "failed to write artifact %s", key)
+	}
+	if written != size {
+		return errors.Errorf("artifact %s is %d bytes, expected %d", key, written, size)
+	}
+	if err := tmp.Sync(); err != nil {
+		return errors.Wrapf(err, "failed to sync artifact %s", key)
+	}
+	if err := verifyFile(tmp, size, hash.Sum(nil)); err != nil {
+		return errors.Wrapf(err, "artifact %s was not written correctly", key)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close artifact %s", key)
+	}
+
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return errors.Wrapf(err, "failed to publish artifact %s", key)
+	}
+	published = true
+	syncDir(filepath.Dir(dest))
+	return nil
+}
+
+// Move publishes the file at path under key and removes it. The file is renamed into place
+// when it lives on the same filesystem as the store, and copied atomically otherwise.
+func (s *LocalStore) Move(ctx context.Context, key, path string) error {
+	dest, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	source, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat %s", path)
+	}
+	// The converter may not have synced its output; make it durable before it becomes visible.
+	if err := source.Sync(); err != nil {
+		return errors.Wrapf(err, "failed to sync %s", path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "failed to create artifact directory for %s", key)
+	}
+	err = rename(path, dest)
+	if err == nil {
+		syncDir(filepath.Dir(dest))
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return errors.Wrapf(err, "failed to move %s to artifact %s", path, key)
+	}
+
+	if err := s.Put(ctx, key, source, info.Size()); err != nil {
+		return err
+	}
+	source.Close()
+	if err := os.Remove(path); err != nil {
+		return errors.Wrapf(err, "artifact %s was published but %s could not be removed", key, path)
+	}
+	return nil
+}
+
+// Copy hard-links the artifact under its new key, sharing the data on disk, and falls back to
+// an atomic copy when linking is not possible.
+func (s *LocalStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.path(srcKey)
+	if err != nil {
+		return err
+	}
+	dest, err := s.path(dstKey)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		return errors.Wrap(ErrNotFound, srcKey)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat artifact %s", srcKey)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "failed to create artifact directory for %s", dstKey)
+	}
+
+	// Link under a temporary name first; a link cannot replace an existing artifact.
+	tmp := filepath.Join(filepath.Dir(dest), "."+filepath.Base(dest)+strings.TrimSuffix(tempSuffix, "*")+"link")
+	_ = os.Remove(tmp)
+	if err := os.Link(src, tmp); err == nil {
+		if err := os.Rename(tmp, dest); err != nil {
+			_ = os.Remove(tmp)
+			return errors.Wrapf(err, "failed to publish artifact %s", dstKey)
+		}
+		return nil
+	}
+
+	file, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open artifact %s", srcKey)
+	}
+	defer file.Close()
+	return s.Put(ctx, dstKey, file, info.Size())
+}
+
+func (s *LocalStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.Wrap(ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open artifact %s", key)
+	}
+	return file, nil
+}
+
+func (s *LocalStore) Stat(_ context.Context, key string) (*Info, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return nil, errors.Wrap(ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to stat artifact %s", key)
+	}
+	return &Info{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *LocalStore) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errors.Wrapf(err, "failed to delete artifact %s", key)
+	}
+	// Drop the file and post directories once their last artifact is gone. Removing a directory
+	// that still has entries fails, which ends the walk up to the root.
+	for dir := filepath.Dir(p); dir != filepath.Clean(s.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *LocalStore) List(_ context.Context, prefix string) ([]Info, error) {
+	var infos []Info
+	err := filepath.WalkDir(s.root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if p == s.root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || isTempFile(entry.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		infos = append(infos, Info{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list artifacts")
+	}
+	return infos, nil
+}
+
+// PurgeTemp removes the temporary files of writes that were interrupted before they were
+// renamed into place.
+func (s *LocalStore) PurgeTemp(_ context.Context, before time.Time) (int, int64, error) {
+	var (
+		count int
+		size  int64
+	)
+	err := filepath.WalkDir(s.root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if p == s.root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || !isTempFile(entry.Name()) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		count++
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return count, size, errors.Wrap(err, "failed to purge temporary files")
+	}
+	return count, size, nil
+}
+
+// isTempFile reports whether name is an artifact still being written by Put.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, strings.TrimSuffix(tempSuffix, "*"))
+}
+
+// verifyFile re-reads the file from the start and checks its size and SHA-256 checksum.
+func verifyFile(file *os.File, size int64, checksum []byte) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	read, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	if read != size {
+		return errors.Errorf("%d bytes on disk, expected %d", read, size)
+	}
+	if !bytes.Equal(hash.Sum(nil), checksum) {
+		return errors.New("checksum mismatch")
+	}
+	return nil
+}
+
+// syncDir makes a rename in the directory durable. It is best effort; some platforms cannot
+// sync directories.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,203 @@
+package artifactstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckKey(t *testing.T) {
+	for _, key := range []string{"post/plan.esob", "plan.esob", "a/b/c.esob"} {
+		assert.NoError(t, CheckKey(key), key)
+	}
+	for _, key := range []string{"", "/etc/passwd", "../plan.esob", "post/../../plan.esob", "post//plan.esob", "post/./plan.esob", `post\plan.esob`, "post/"} {
+		assert.ErrorIs(t, CheckKey(key), ErrInvalidKey, key)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store := NewLocalStore(root)
+
+	require.NoError(t, store.Put(ctx, "post/plan.esob", strings.NewReader("artifact"), 8))
+	content, err := os.ReadFile(filepath.Join(root, "post", "plan.esob"))
+	require.NoError(t, err)
+	assert.Equal(t, "artifact", string(content))
+
+	reader, err := store.Get(ctx, "post/plan.esob")
+	require.NoError(t, err)
+	content, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, "artifact", string(content))
+
+	info, err := store.Stat(ctx, "post/plan.esob")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), info.Size)
+
+	require.NoError(t, store.Put(ctx, "other/site.esob", strings.NewReader("x"), 1))
+	infos, err := store.List(ctx, "post/")
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "post/plan.esob", infos[0].Key)
+
+	require.NoError(t, store.Delete(ctx, "post/plan.esob"))
+	require.NoError(t, store.Delete(ctx, "post/plan.esob"), "deleting twice is not an error")
+	assert.NoDirExists(t, filepath.Join(root, "post"))
+	assert.DirExists(t, root)
+
+	// The post directory goes with the last file directory under it.
+	require.NoError(t, store.Put(ctx, "post/file1/plan.esob", strings.NewReader("x"), 1))
+	require.NoError(t, store.Put(ctx, "post/file2/plan.esob", strings.NewReader("x"), 1))
+	require.NoError(t, store.Delete(ctx, "post/file1/plan.esob"))
+	assert.NoDirExists(t, filepath.Join(root, "post", "file1"))
+	assert.DirExists(t, filepath.Join(root, "post", "file2"))
+	require.NoError(t, store.Delete(ctx, "post/file2/plan.esob"))
+	assert.NoDirExists(t, filepath.Join(root, "post"))
+	assert.DirExists(t, root)
+
+	_, err = store.Stat(ctx, "post/plan.esob")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Get(ctx, "post/plan.esob")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.ErrorIs(t, store.Put(ctx, "../escape.esob", strings.NewReader("x"), 1), ErrInvalidKey)
+	assert.Error(t, store.Put(ctx, "post/short.esob", strings.NewReader("x"), 2), "a size mismatch fails the upload")
+}
+
+func TestLocalStorePutIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store := NewLocalStore(root)
+	require.NoError(t, store.Put(ctx, "post/plan.esob", strings.NewReader("original"), 8))
+
+	// A failed upload leaves the published artifact untouched and no temporary file behind.
+	assert.Error(t, store.Put(ctx, "post/plan.esob", iotest.ErrReader(errors.New("disk full")), 8))
+	assert.Error(t, store.Put(ctx, "post/plan.esob", strings.NewReader("short"), 8))
+
+	content, err := os.ReadFile(filepath.Join(root, "post", "plan.esob"))
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(content))
+	entries, err := os.ReadDir(filepath.Join(root, "post"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestLocalStoreMove(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name        string
+		crossDevice bool
+	}{
+		{name: "same filesystem"},
+		{name: "across filesystems", crossDevice: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.crossDevice {
+				rename = func(oldpath, newpath string) error {
+					return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+				}
+				t.Cleanup(func() { rename = os.Rename })
+			}
+
+			root := t.TempDir()
+			store := NewLocalStore(root)
+			source := filepath.Join(t.TempDir(), "plan.esob")
+			require.NoError(t, os.WriteFile(source, []byte("artifact"), 0600))
+
+			require.NoError(t, store.Move(ctx, "post/plan.esob", source))
+
+			content, err := os.ReadFile(filepath.Join(root, "post", "plan.esob"))
+			require.NoError(t, err)
+			assert.Equal(t, "artifact", string(content))
+			assert.NoFileExists(t, source)
+		})
+	}
+}
+
+func TestLocalStoreListSkipsTempFiles(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "post"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "post", ".plan.esob.tmp-123"), nil, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "post", "plan.esob"), nil, 0600))
+
+	infos, err := NewLocalStore(root).List(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "post/plan.esob", infos[0].Key)
+}
+
+func TestLocalStorePurgeTemp(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "post", "file")
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	stale := filepath.Join(dir, ".plan.esob.tmp-123")
+	fresh := filepath.Join(dir, ".plan.esob.tmp-456")
+	artifact := filepath.Join(dir, "plan.esob")
+	for _, name := range []string{stale, fresh, artifact} {
+		require.NoError(t, os.WriteFile(name, []byte("data"), 0600))
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+	require.NoError(t, os.Chtimes(artifact, old, old))
+
+	count, size, err := NewLocalStore(root).PurgeTemp(context.Background(), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.EqualValues(t, 4, size)
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, fresh, "a write still in progress is kept")
+	assert.FileExists(t, artifact, "published artifacts are never purged")
+}
+
+func TestLocalStoreListMissingRoot(t *testing.T) {
+	infos, err := NewLocalStore(filepath.Join(t.TempDir(), "missing")).List(context.Background(), "")
+	require.NoError(t, err)
+	assert.Empty(t, infos)
+}
+
+func TestLocalStoreCopy(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store := NewLocalStore(root)
+	require.NoError(t, store.Put(ctx, "post/a/plan.esob", strings.NewReader("artifact"), 8))
+	require.NoError(t, store.Put(ctx, "other/b/plan.esob", strings.NewReader("stale"), 5))
+
+	require.NoError(t, store.Copy(ctx, "post/a/plan.esob", "other/b/plan.esob"))
+
+	src, err := os.Stat(filepath.Join(root, "post", "a", "plan.esob"))
+	require.NoError(t, err)
+	dst, err := os.Stat(filepath.Join(root, "other", "b", "plan.esob"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(src, dst), "the copy is a hard link")
+
+	assert.ErrorIs(t, store.Copy(ctx, "missing/plan.esob", "other/c/plan.esob"), ErrNotFound)
+}
+
+// putOnlyStore hides the native Copy of the local store.
+type putOnlyStore struct{ ArtifactStore }
+
+func TestCopyFallback(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store := putOnlyStore{NewLocalStore(root)}
+	require.NoError(t, store.Put(ctx, "post/a/plan.esob", strings.NewReader("artifact"), 8))
+
+	require.NoError(t, Copy(ctx, store, "post/a/plan.esob", "other/b/plan.esob"))
+
+	content, err := os.ReadFile(filepath.Join(root, "other", "b", "plan.esob"))
+	require.NoError(t, err)
+	assert.Equal(t, "artifact", string(content))
+}
@@ -0,0 +1,167 @@
+package artifactstore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+)
+
+// s3MaxAttempts bounds how often minio-go sends a request failing with a network error, a
+// throttling or a server error.
+const s3MaxAttempts = 3
+
+// S3Options configures an S3-compatible store such as AWS S3 or MinIO.
+type S3Options struct {
+	// Endpoint is the base URL of the service, e.g. https://s3.ap-northeast-2.amazonaws.com
+	// or http://minio:9000. Objects are addressed path-style.
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Prefix is prepended to every artifact key, e.g. "plugins/collabview/".
+	Prefix string
+	// Transport defaults to minio-go's; timeouts are expected to come from the context.
+	Transport http.RoundTripper
+}
+
+// S3Store keeps artifacts as objects of an S3-compatible bucket through minio-go, which signs
+// the requests, checksums the uploads and retries transient failures.
+type S3Store struct {
+	opts     S3Options
+	endpoint *url.URL
+	client   *minio.Client
+}
+
+// NewS3Store returns a store writing to the configured bucket.
+func NewS3Store(opts S3Options) (*S3Store, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(opts.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Path != "" {
+		return nil, errors.Errorf("invalid s3 endpoint %q", opts.Endpoint)
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(opts.AccessKeyID, opts.SecretAccessKey, ""),
+		Secure:       endpoint.Scheme == "https",
+		Region:       opts.Region,
+		BucketLookup: minio.BucketLookupPath,
+		Transport:    opts.Transport,
+		MaxRetries:   s3MaxAttempts,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create s3 client")
+	}
+	return &S3Store{opts: opts, endpoint: endpoint, client: client}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(ctx, s.opts.Bucket, s.opts.Prefix+key, r, size, minio.PutObjectOptions{
+		ContentType: defaultContentType,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload artifact %s", key)
+	}
+	return nil
+}
+
+// Copy duplicates the object on the server side.
+func (s *S3Store) Copy(ctx context.Context, srcKey, dstKey string) error {
+	if err := CheckKey(srcKey); err != nil {
+		return err
+	}
+	if err := CheckKey(dstKey); err != nil {
+		return err
+	}
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.opts.Bucket, Object: s.opts.Prefix + dstKey},
+		minio.CopySrcOptions{Bucket: s.opts.Bucket, Object: s.opts.Prefix + srcKey},
+	)
+	if err != nil {
+		return wrapS3Error(err, srcKey, "failed to copy artifact")
+	}
+	return nil
+}
+
+// Get opens the artifact. The object is stat'ed first, since minio-go only reports a missing
+// object on the first read.
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(ctx, s.opts.Bucket, s.opts.Prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, wrapS3Error(err, key, "failed to download artifact")
+	}
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, wrapS3Error(err, key, "failed to download artifact")
+	}
+	return object, nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (*Info, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, err
+	}
+	object, err := s.client.StatObject(ctx, s.opts.Bucket, s.opts.Prefix+key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, wrapS3Error(err, key, "failed to stat artifact")
+	}
+	return &Info{Key: key, Size: object.Size, ModTime: object.LastModified}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	err := s.client.RemoveObject(ctx, s.opts.Bucket, s.opts.Prefix+key, minio.RemoveObjectOptions{})
+	if err != nil && !isNotFound(err) {
+		return errors.Wrapf(err, "failed to delete artifact %s", key)
+	}
+	return nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]Info, error) {
+	var infos []Info
+	for object := range s.client.ListObjects(ctx, s.opts.Bucket, minio.ListObjectsOptions{
+		Prefix:    s.opts.Prefix + prefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return nil, errors.Wrap(object.Err, "failed to list artifacts")
+		}
+		infos = append(infos, Info{
+			Key:     strings.TrimPrefix(object.Key, s.opts.Prefix),
+			Size:    object.Size,
+			ModTime: object.LastModified,
+		})
+	}
+	return infos, nil
+}
+
+func wrapS3Error(err error, key, message string) error {
+	if isNotFound(err) {
+		return errors.Wrap(ErrNotFound, key)
+	}
+	return errors.Wrapf(err, "%s %s", message, key)
+}
+
+func isNotFound(err error) bool {
+	var response minio.ErrorResponse
+	return errors.As(err, &response) && (response.StatusCode == http.StatusNotFound || response.Code == "NoSuchKey")
+}
@@ -0,0 +1,321 @@
+package artifactstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccessKeyID     = "minioadmin"
+	testSecretAccessKey = "minioadmin-secret"
+	testBucket          = "collabview"
+)
+
+// minioStub is an in-memory, path-style S3 endpoint that checks every request signature.
+type minioStub struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string][]byte
+	// pageSize forces ListObjectsV2 to paginate.
+	pageSize int
+	// failures is the number of upcoming requests answered with 503 SlowDown.
+	failures int
+	requests int
+	// lastPayloadHash is the X-Amz-Content-Sha256 of the last upload.
+	lastPayloadHash string
+	url             string
+}
+
+func newMinioStub(t *testing.T) (*minioStub, *S3Store) {
+	stub := &minioStub{t: t, objects: map[string][]byte{}, pageSize: 1}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	stub.url = server.URL
+
+	store, err := NewS3Store(S3Options{
+		Endpoint:        server.URL,
+		Bucket:          testBucket,
+		Region:          "ap-northeast-2",
+		AccessKeyID:     testAccessKeyID,
+		SecretAccessKey: testSecretAccessKey,
+		Prefix:          "artifacts/",
+	})
+	require.NoError(t, err)
+	return stub, store
+}
+
+func (m *minioStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !m.validSignature(r) {
+		m.writeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	m.mu.Lock()
+	m.requests++
+	if m.failures > 0 {
+		m.failures--
+		m.mu.Unlock()
+		m.writeError(w, http.StatusServiceUnavailable, "SlowDown")
+		return
+	}
+	m.mu.Unlock()
+
+	bucketPrefix := "/" + testBucket
+	if (r.URL.Path == bucketPrefix || r.URL.Path == bucketPrefix+"/") && r.Method == http.MethodGet {
+		m.list(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, bucketPrefix+"/") {
+		m.writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, bucketPrefix+"/")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			unescaped, err := url.PathUnescape(source)
+			require.NoError(m.t, err)
+			body, ok := m.objects[strings.TrimPrefix(strings.TrimPrefix(unescaped, "/"), testBucket+"/")]
+			if !ok {
+				m.writeError(w, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			m.objects[key] = body
+			fmt.Fprint(w, "<CopyObjectResult></CopyObjectResult>")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			m.writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+		switch payloadHash {
+		case s3StreamingPayload:
+			body = decodeChunkedPayload(m.t, body)
+		case "UNSIGNED-PAYLOAD":
+		default:
+			if payloadHash != sha256Hex(body) {
+				m.writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+				return
+			}
+		}
+		m.lastPayloadHash = payloadHash
+		m.objects[key] = body
+	case http.MethodGet, http.MethodHead:
+		body, ok := m.objects[key]
+		if !ok {
+			m.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		w.Header().Set("Last-Modified", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(body)
+		}
+	case http.MethodDelete:
+		delete(m.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		m.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (m *minioStub) list(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if token := r.URL.Query().Get("continuation-token"); token != "" {
+		start = sort.SearchStrings(keys, token)
+	}
+	end := min(start+m.pageSize, len(keys))
+
+	type object struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []object `xml:"Contents"`
+		IsTruncated           bool     `xml:"IsTruncated"`
+		NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+	}{}
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, object{Key: key, Size: int64(len(m.objects[key]))})
+	}
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[end]
+	}
+	require.NoError(m.t, xml.NewEncoder(w).Encode(result))
+}
+
+func (m *minioStub) writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>stub error</Message></Error>", code)
+}
+
+// validSignature checks that the request is signed with Signature Version 4 for the test
+// credentials and region; minio-go owns the signature itself.
+func (m *minioStub) validSignature(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+testAccessKeyID+"/") &&
+		strings.Contains(r.Header.Get("Authorization"), "/ap-northeast-2/s3/aws4_request")
+}
+
+func TestS3Store(t *testing.T) {
+	ctx := context.Background()
+	stub, store := newMinioStub(t)
+
+	require.NoError(t, store.Put(ctx, "post/도면 (1).esob", strings.NewReader("artifact"), 8))
+	require.NoError(t, store.Put(ctx, "post/plan.esob", strings.NewReader("plan"), 4))
+	require.NoError(t, store.Put(ctx, "other/site.esob", strings.NewReader("site"), 4))
+	assert.Equal(t, []byte("artifact"), stub.objects["artifacts/post/도면 (1).esob"])
+
+	reader, err := store.Get(ctx, "post/도면 (1).esob")
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, "artifact", string(content))
+
+	info, err := store.Stat(ctx, "post/plan.esob")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), info.Size)
+	assert.False(t, info.ModTime.IsZero())
+
+	infos, err := store.List(ctx, "post/")
+	require.NoError(t, err)
+	keys := make([]string, 0, len(infos))
+	for _, info := range infos {
+		keys = append(keys, info.Key)
+	}
+	assert.ElementsMatch(t, []string{"post/도면 (1).esob", "post/plan.esob"}, keys)
+
+	require.NoError(t, store.Copy(ctx, "post/plan.esob", "copy/plan.esob"))
+	assert.Equal(t, []byte("plan"), stub.objects["artifacts/copy/plan.esob"])
+	assert.ErrorIs(t, store.Copy(ctx, "missing/plan.esob", "copy/other.esob"), ErrNotFound)
+
+	require.NoError(t, store.Delete(ctx, "post/plan.esob"))
+	require.NoError(t, store.Delete(ctx, "post/plan.esob"), "deleting twice is not an error")
+
+	_, err = store.Stat(ctx, "post/plan.esob")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Get(ctx, "post/plan.esob")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, store.Put(ctx, "../escape.esob", strings.NewReader("x"), 1), ErrInvalidKey)
+}
+
+func TestS3StorePutSignsPayload(t *testing.T) {
+	ctx := context.Background()
+	stub, store := newMinioStub(t)
+
+	require.NoError(t, store.Put(ctx, "post/plan.esob", strings.NewReader("plan"), 4))
+	assert.Equal(t, []byte("plan"), stub.objects["artifacts/post/plan.esob"])
+	assert.Equal(t, s3StreamingPayload, stub.lastPayloadHash, "every chunk of the payload is signed over plain HTTP")
+
+	require.NoError(t, store.Put(ctx, "post/stream.esob", io.MultiReader(strings.NewReader("stream")), 6))
+	assert.Equal(t, []byte("stream"), stub.objects["artifacts/post/stream.esob"])
+
+	assert.Error(t, store.Put(ctx, "post/short.esob", strings.NewReader("plan"), 10), "a size mismatch is caught before uploading")
+	assert.NotContains(t, stub.objects, "artifacts/post/short.esob")
+}
+
+func TestS3StoreRetriesTransientFailures(t *testing.T) {
+	ctx := context.Background()
+	stub, store := newMinioStub(t)
+
+	stub.failures = s3MaxAttempts - 1
+	require.NoError(t, store.Put(ctx, "post/plan.esob", strings.NewReader("plan"), 4))
+	assert.Equal(t, []byte("plan"), stub.objects["artifacts/post/plan.esob"])
+	assert.Equal(t, s3MaxAttempts, stub.requests)
+
+	stub.requests = 0
+	stub.failures = s3MaxAttempts
+	_, err := store.Stat(ctx, "post/plan.esob")
+	var response minio.ErrorResponse
+	require.ErrorAs(t, err, &response)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, s3MaxAttempts, stub.requests, "the attempts are bounded")
+}
+
+func TestS3StoreRejectsBadCredentials(t *testing.T) {
+	stub, _ := newMinioStub(t)
+	store, err := NewS3Store(S3Options{
+		Endpoint:        stub.url,
+		Bucket:          testBucket,
+		Region:          "ap-northeast-2",
+		AccessKeyID:     "wrong",
+		SecretAccessKey: testSecretAccessKey,
+	})
+	require.NoError(t, err)
+
+	err = store.Put(context.Background(), "post/plan.esob", strings.NewReader("plan"), 4)
+	var response minio.ErrorResponse
+	require.ErrorAs(t, err, &response)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	assert.Equal(t, "SignatureDoesNotMatch", response.Code)
+}
+
+// s3StreamingPayload marks an aws-chunked body whose every chunk carries its own signature.
+const s3StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+
+// decodeChunkedPayload strips the "<size>;chunk-signature=<signature>" framing of an
+// aws-chunked body.
+func decodeChunkedPayload(t *testing.T, body []byte) []byte {
+	var decoded []byte
+	for {
+		header, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		require.True(t, ok, "truncated chunk header")
+		sizeHex, signature, _ := bytes.Cut(header, []byte(";"))
+		require.True(t, bytes.HasPrefix(signature, []byte("chunk-signature=")), "unsigned chunk")
+		size, err := strconv.ParseInt(string(sizeHex), 16, 64)
+		require.NoError(t, err)
+		if size == 0 {
+			return decoded
+		}
+		decoded = append(decoded, rest[:size]...)
+		body = rest[size+2:]
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestNewS3StoreValidatesEndpoint(t *testing.T) {
+	_, err := NewS3Store(S3Options{Endpoint: "minio:9000", Bucket: testBucket})
+	assert.Error(t, err)
+	_, err = NewS3Store(S3Options{Endpoint: "http://minio:9000"})
+	assert.Error(t, err)
+}
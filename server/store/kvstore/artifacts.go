@@ -0,0 +1,69 @@
+package kvstore
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const artifactKeyPrefix = "artifact-"
+
+// Artifact is the manifest entry mapping an attachment to its published artifact.
+type Artifact struct {
+	FileID string `json:"file_id"`
+	PostID string `json:"post_id"`
+	// Key locates the artifact in the artifact store.
+	Key string `json:"key"`
+	// Name is the attachment's original display name.
+	Name string `json:"name"`
+	// Format is the artifact's file extension without the dot, e.g. esob or pdf.
+	Format      string `json:"format,omitempty"`
+	Size        int64  `json:"size"`
+	Converter   string `json:"converter"`
+	PublishedAt int64  `json:"published_at"`
+	// ContentHash and ConverterVersion identify the conversion cache entry of the artifact;
+	// both are empty when the converter does not support caching.
+	ContentHash      string `json:"content_hash,omitempty"`
+	ConverterVersion string `json:"converter_version,omitempty"`
+}
+
+func (kv Client) SaveArtifact(artifact *Artifact) error {
+	if _, err := kv.client.KV.Set(artifactKeyPrefix+artifact.FileID, artifact); err != nil {
+		return errors.Wrapf(err, "failed to save artifact of file %s", artifact.FileID)
+	}
+	return nil
+}
+
+func (kv Client) GetArtifact(fileID string) (*Artifact, error) {
+	var artifact *Artifact
+	if err := kv.client.KV.Get(artifactKeyPrefix+fileID, &artifact); err != nil {
+		return nil, errors.Wrapf(err, "failed to get artifact of file %s", fileID)
+	}
+	return artifact, nil
+}
+
+func (kv Client) DeleteArtifact(fileID string) error {
+	if err := kv.client.KV.Delete(artifactKeyPrefix + fileID); err != nil {
+		return errors.Wrapf(err, "failed to delete artifact of file %s", fileID)
+	}
+	return nil
+}
+
+func (kv Client) ListArtifacts() ([]*Artifact, error) {
+	keys, err := kv.listKeysWithPrefix(artifactKeyPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list artifacts")
+	}
+
+	artifacts := make([]*Artifact, 0, len(keys))
+	for _, key := range keys {
+		artifact, err := kv.GetArtifact(strings.TrimPrefix(key, artifactKeyPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if artifact != nil {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts, nil
+}
@@ -0,0 +1,151 @@
+package kvstore
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+	"github.com/pkg/errors"
+)
+
+const backfillKeyPrefix = "backfill-"
+
+// BackfillState describes where a backfill is in its lifecycle.
+type BackfillState string
+
+const (
+	BackfillStateRunning   BackfillState = "running"
+	BackfillStateCompleted BackfillState = "completed"
+	BackfillStateCanceled  BackfillState = "canceled"
+)
+
+// Backfill is an admin-requested conversion of the attachments posted before the plugin was
+// installed. Channels are walked one after the other from their newest post back to Since; the
+// cursor is checkpointed after every page so that the backfill resumes where it stopped.
+type Backfill struct {
+	ID     string `json:"id"`
+	TeamID string `json:"team_id,omitempty"`
+	// ChannelIDs lists the channels to walk, in order.
+	ChannelIDs []string `json:"channel_ids"`
+	// Since is the creation time, in milliseconds, of the oldest posts to convert.
+	Since       int64  `json:"since"`
+	RequestedBy string `json:"requested_by"`
+	// ReplyChannelID is where progress is reported to the requester, if the backfill was
+	// started from a slash command.
+	ReplyChannelID string        `json:"reply_channel_id,omitempty"`
+	State          BackfillState `json:"state"`
+
+	// ChannelIndex is the channel currently walked.
+	ChannelIndex int `json:"channel_index"`
+	// ChannelStartAt is the creation time of the newest post of the current channel.
+	ChannelStartAt int64 `json:"channel_start_at,omitempty"`
+	// CursorPostID is the last post processed in the current channel, and CursorAt its creation time.
+	CursorPostID string `json:"cursor_post_id,omitempty"`
+	CursorAt     int64  `json:"cursor_at,omitempty"`
+
+	Posts     int    `json:"posts"`
+	Files     int    `json:"files"`
+	Enqueued  int    `json:"enqueued"`
+	Errors    int    `json:"errors"`
+	LastError string `json:"last_error,omitempty"`
+
+	CreatedAt  int64 `json:"created_at"`
+	UpdatedAt  int64 `json:"updated_at"`
+	FinishedAt int64 `json:"finished_at,omitempty"`
+}
+
+// IsFinished reports whether the backfill reached a terminal state.
+func (b *Backfill) IsFinished() bool {
+	return b.State == BackfillStateCompleted || b.State == BackfillStateCanceled
+}
+
+// Progress estimates the completed share of the backfill, between 0 and 1, from how far back
+// in time the current channel has been walked.
+func (b *Backfill) Progress() float64 {
+	if b.State == BackfillStateCompleted || len(b.ChannelIDs) == 0 {
+		return 1
+	}
+
+	var channel float64
+	if b.CursorAt > 0 && b.ChannelStartAt > b.Since {
+		channel = float64(b.ChannelStartAt-b.CursorAt) / float64(b.ChannelStartAt-b.Since)
+		channel = min(max(channel, 0), 1)
+	}
+	return min((float64(b.ChannelIndex)+channel)/float64(len(b.ChannelIDs)), 1)
+}
+
+// ETA extrapolates the remaining time from the progress made so far. It is zero while the
+// backfill has not progressed enough to tell, and once it finished.
+func (b *Backfill) ETA(now time.Time) time.Duration {
+	progress := b.Progress()
+	if b.IsFinished() || progress <= 0 || progress >= 1 {
+		return 0
+	}
+	elapsed := now.Sub(time.UnixMilli(b.CreatedAt))
+	return time.Duration(float64(elapsed) * (1 - progress) / progress)
+}
+
+func (kv Client) SaveBackfill(backfill *Backfill) error {
+	if _, err := kv.client.KV.Set(backfillKeyPrefix+backfill.ID, backfill); err != nil {
+		return errors.Wrapf(err, "failed to save backfill %s", backfill.ID)
+	}
+	return nil
+}
+
+func (kv Client) SaveBackfillCheckpoint(backfill *Backfill) (bool, error) {
+	key := backfillKeyPrefix + backfill.ID
+	for {
+		var raw []byte
+		if err := kv.client.KV.Get(key, &raw); err != nil {
+			return false, errors.Wrapf(err, "failed to get backfill %s", backfill.ID)
+		}
+		if raw == nil {
+			return false, nil
+		}
+		var current *Backfill
+		if err := json.Unmarshal(raw, &current); err != nil {
+			return false, errors.Wrapf(err, "failed to decode backfill %s", backfill.ID)
+		}
+		if current.State == BackfillStateCanceled {
+			return false, nil
+		}
+
+		// The checkpoint only replaces the record it was checked against, so a cancellation
+		// saved in between is read again instead of being overwritten.
+		saved, err := kv.client.KV.Set(key, backfill, pluginapi.SetAtomic(raw))
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to save backfill %s", backfill.ID)
+		}
+		if saved {
+			return true, nil
+		}
+	}
+}
+
+func (kv Client) GetBackfill(backfillID string) (*Backfill, error) {
+	var backfill *Backfill
+	if err := kv.client.KV.Get(backfillKeyPrefix+backfillID, &backfill); err != nil {
+		return nil, errors.Wrapf(err, "failed to get backfill %s", backfillID)
+	}
+	return backfill, nil
+}
+
+func (kv Client) ListBackfills() ([]*Backfill, error) {
+	keys, err := kv.listKeysWithPrefix(backfillKeyPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list backfills")
+	}
+
+	backfills := make([]*Backfill, 0, len(keys))
+	for _, key := range keys {
+		backfill, err := kv.GetBackfill(strings.TrimPrefix(key, backfillKeyPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if backfill != nil {
+			backfills = append(backfills, backfill)
+		}
+	}
+	return backfills, nil
+}
@@ -0,0 +1,197 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newMemoryClient returns a client backed by kv. beforeSet, if set, runs before every write is
+// applied, as a concurrent writer would.
+func newMemoryClient(kv map[string][]byte, beforeSet func()) Client {
+	api := &plugintest.API{}
+	api.On("KVGet", mock.Anything).Return(func(key string) []byte {
+		return kv[key]
+	}, nil)
+	api.On("KVSetWithOptions", mock.Anything, mock.Anything, mock.Anything).Return(func(key string, value []byte, options model.PluginKVSetOptions) bool {
+		if beforeSet != nil {
+			beforeSet()
+		}
+		if current, ok := kv[key]; options.Atomic && (ok != (options.OldValue != nil) || !bytes.Equal(current, options.OldValue)) {
+			return false
+		}
+		if value == nil {
+			delete(kv, key)
+		} else {
+			kv[key] = value
+		}
+		return true
+	}, nil)
+	api.On("KVList", mock.Anything, mock.Anything).Return(func(page, perPage int) []string {
+		keys := make([]string, 0, len(kv))
+		for key := range kv {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if page*perPage >= len(keys) {
+			return []string{}
+		}
+		return keys[page*perPage : min((page+1)*perPage, len(keys))]
+	}, nil)
+	return Client{client: pluginapi.NewClient(api, nil)}
+}
+
+func TestBackfillProgress(t *testing.T) {
+	for name, tc := range map[string]struct {
+		backfill Backfill
+		expected float64
+	}{
+		"not started": {
+			backfill: Backfill{ChannelIDs: []string{"a", "b"}, Since: 1000},
+			expected: 0,
+		},
+		"halfway through the first channel": {
+			backfill: Backfill{ChannelIDs: []string{"a", "b"}, Since: 1000, ChannelStartAt: 3000, CursorAt: 2000},
+			expected: 0.25,
+		},
+		"second channel not started": {
+			backfill: Backfill{ChannelIDs: []string{"a", "b"}, Since: 1000, ChannelIndex: 1},
+			expected: 0.5,
+		},
+		"cursor older than the start date": {
+			backfill: Backfill{ChannelIDs: []string{"a", "b"}, Since: 1000, ChannelIndex: 1, ChannelStartAt: 3000, CursorAt: 500},
+			expected: 1,
+		},
+		"past the last channel": {
+			backfill: Backfill{ChannelIDs: []string{"a"}, ChannelIndex: 1},
+			expected: 1,
+		},
+		"completed": {
+			backfill: Backfill{ChannelIDs: []string{"a"}, State: BackfillStateCompleted},
+			expected: 1,
+		},
+		"no channels": {
+			backfill: Backfill{},
+			expected: 1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.InDelta(t, tc.expected, tc.backfill.Progress(), 0.0001)
+		})
+	}
+}
+
+func TestBackfillETA(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := createdAt.Add(10 * time.Minute)
+
+	running := Backfill{ChannelIDs: []string{"a", "b"}, ChannelIndex: 1, State: BackfillStateRunning, CreatedAt: createdAt.UnixMilli()}
+	assert.Equal(t, 10*time.Minute, running.ETA(now), "half done after ten minutes")
+
+	notStarted := Backfill{ChannelIDs: []string{"a"}, State: BackfillStateRunning, CreatedAt: createdAt.UnixMilli()}
+	assert.Zero(t, notStarted.ETA(now), "no progress to extrapolate from")
+
+	canceled := running
+	canceled.State = BackfillStateCanceled
+	assert.Zero(t, canceled.ETA(now))
+}
+
+func TestSaveBackfillCheckpoint(t *testing.T) {
+	running := &Backfill{ID: "backfill", ChannelIDs: []string{"a"}, State: BackfillStateRunning}
+
+	t.Run("saves the cursor", func(t *testing.T) {
+		kv := map[string][]byte{}
+		client := newMemoryClient(kv, nil)
+		require.NoError(t, client.SaveBackfill(running))
+
+		checkpoint := *running
+		checkpoint.CursorPostID = "post"
+		checkpoint.CursorAt = 2000
+		saved, err := client.SaveBackfillCheckpoint(&checkpoint)
+		require.NoError(t, err)
+		assert.True(t, saved)
+
+		stored, err := client.GetBackfill("backfill")
+		require.NoError(t, err)
+		assert.Equal(t, "post", stored.CursorPostID)
+		assert.EqualValues(t, 2000, stored.CursorAt)
+	})
+
+	t.Run("keeps a cancellation", func(t *testing.T) {
+		kv := map[string][]byte{}
+		client := newMemoryClient(kv, nil)
+		canceled := *running
+		canceled.State = BackfillStateCanceled
+		require.NoError(t, client.SaveBackfill(&canceled))
+
+		saved, err := client.SaveBackfillCheckpoint(running)
+		require.NoError(t, err)
+		assert.False(t, saved)
+		stored, err := client.GetBackfill("backfill")
+		require.NoError(t, err)
+		assert.Equal(t, BackfillStateCanceled, stored.State)
+	})
+
+	t.Run("keeps a cancellation racing the checkpoint", func(t *testing.T) {
+		kv := map[string][]byte{}
+		canceled := *running
+		canceled.State = BackfillStateCanceled
+		raced := false
+		client := newMemoryClient(kv, func() {
+			// The cancellation lands after the checkpoint read the record.
+			if !raced {
+				raced = true
+				kv["backfill-backfill"], _ = json.Marshal(&canceled)
+			}
+		})
+		kv["backfill-backfill"], _ = json.Marshal(running)
+
+		saved, err := client.SaveBackfillCheckpoint(running)
+		require.NoError(t, err)
+		assert.True(t, raced)
+		assert.False(t, saved)
+		stored, err := client.GetBackfill("backfill")
+		require.NoError(t, err)
+		assert.Equal(t, BackfillStateCanceled, stored.State)
+	})
+
+	t.Run("ignores a deleted backfill", func(t *testing.T) {
+		client := newMemoryClient(map[string][]byte{}, nil)
+
+		saved, err := client.SaveBackfillCheckpoint(running)
+		require.NoError(t, err)
+		assert.False(t, saved)
+	})
+}
+
+func TestListBackfillsPagesThroughKeys(t *testing.T) {
+	kv := map[string][]byte{}
+	client := newMemoryClient(kv, nil)
+
+	// More keys than fit on one page, sorted before the backfills so that they land on the last page.
+	for i := 0; i < 2*listKeysPerPage+10; i++ {
+		kv[fmt.Sprintf("artifact-%04d", i)] = []byte(`{}`)
+	}
+	for _, id := range []string{"first", "second", "third"} {
+		require.NoError(t, client.SaveBackfill(&Backfill{ID: id}))
+	}
+	kv["zz-backfill-other"] = []byte(`{}`)
+
+	backfills, err := client.ListBackfills()
+	require.NoError(t, err)
+	var ids []string
+	for _, backfill := range backfills {
+		ids = append(ids, backfill.ID)
+	}
+	assert.ElementsMatch(t, []string{"first", "second", "third"}, ids)
+}
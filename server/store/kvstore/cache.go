@@ -0,0 +1,107 @@
+package kvstore
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	cacheKeyPrefix = "cache-"
+	cacheStatsKey  = "cachestats"
+)
+
+// CacheEntry points at an artifact already produced from identical content by the same
+// converter version.
+type CacheEntry struct {
+	ContentHash      string `json:"content_hash"`
+	Converter        string `json:"converter"`
+	ConverterVersion string `json:"converter_version"`
+	// ArtifactKey is the artifact reused for every later upload of the same content.
+	ArtifactKey string `json:"artifact_key"`
+	// FileID is the attachment the artifact was first converted from.
+	FileID    string `json:"file_id"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// CacheStats counts conversion cache lookups.
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// cacheKey identifies the artifact of some content converted by a given converter version.
+func cacheKey(contentHash, converter, version string) string {
+	return cacheKeyPrefix + converter + "-" + version + "-" + contentHash
+}
+
+func (kv Client) SaveCacheEntry(entry *CacheEntry) error {
+	if _, err := kv.client.KV.Set(cacheKey(entry.ContentHash, entry.Converter, entry.ConverterVersion), entry); err != nil {
+		return errors.Wrapf(err, "failed to save cache entry %s", entry.ContentHash)
+	}
+	return nil
+}
+
+func (kv Client) GetCacheEntry(contentHash, converter, version string) (*CacheEntry, error) {
+	var entry *CacheEntry
+	if err := kv.client.KV.Get(cacheKey(contentHash, converter, version), &entry); err != nil {
+		return nil, errors.Wrapf(err, "failed to get cache entry %s", contentHash)
+	}
+	return entry, nil
+}
+
+func (kv Client) DeleteCacheEntry(contentHash, converter, version string) error {
+	if err := kv.client.KV.Delete(cacheKey(contentHash, converter, version)); err != nil {
+		return errors.Wrapf(err, "failed to delete cache entry %s", contentHash)
+	}
+	return nil
+}
+
+func (kv Client) ListCacheEntries() ([]*CacheEntry, error) {
+	keys, err := kv.listKeysWithPrefix(cacheKeyPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list cache entries")
+	}
+
+	entries := make([]*CacheEntry, 0, len(keys))
+	for _, key := range keys {
+		var entry *CacheEntry
+		if err := kv.client.KV.Get(key, &entry); err != nil {
+			return nil, errors.Wrapf(err, "failed to get cache entry %s", strings.TrimPrefix(key, cacheKeyPrefix))
+		}
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// RecordCacheLookup counts a hit or a miss. The counters are updated atomically so that every
+// node of a cluster can record lookups concurrently.
+func (kv Client) RecordCacheLookup(hit bool) error {
+	err := kv.client.KV.SetAtomicWithRetries(cacheStatsKey, func(oldValue []byte) (any, error) {
+		var stats CacheStats
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &stats); err != nil {
+				return nil, err
+			}
+		}
+		if hit {
+			stats.Hits++
+		} else {
+			stats.Misses++
+		}
+		return stats, nil
+	})
+	return errors.Wrap(err, "failed to record cache lookup")
+}
+
+func (kv Client) GetCacheStats() (*CacheStats, error) {
+	var stats CacheStats
+	if err := kv.client.KV.Get(cacheStatsKey, &stats); err != nil {
+		return nil, errors.Wrap(err, "failed to get cache stats")
+	}
+	return &stats, nil
+}
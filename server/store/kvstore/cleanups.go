@@ -0,0 +1,129 @@
+package kvstore
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	cleanupKeyPrefix = "cleanup-"
+	auditKeyPrefix   = "audit-"
+)
+
+// CleanupReason tells why the artifacts of some files are removed.
+type CleanupReason string
+
+const (
+	CleanupReasonFilesDetached CleanupReason = "files_detached"
+	CleanupReasonPostDeleted   CleanupReason = "post_deleted"
+	// CleanupReasonExpired and CleanupReasonOrphaned are recorded by the maintenance sweep.
+	CleanupReasonExpired  CleanupReason = "retention_expired"
+	CleanupReasonOrphaned CleanupReason = "post_missing"
+)
+
+// CleanupTask is a pending removal of everything published for some files. It is persisted so
+// that the removal is retried, across plugin restarts, until it succeeds or runs out of attempts.
+type CleanupTask struct {
+	ID        string        `json:"id"`
+	PostID    string        `json:"post_id"`
+	FileIDs   []string      `json:"file_ids"`
+	Reason    CleanupReason `json:"reason"`
+	Attempts  int           `json:"attempts"`
+	LastError string        `json:"last_error,omitempty"`
+	CreatedAt int64         `json:"created_at"`
+	// RemovedKeys accumulates the artifacts deleted by earlier attempts, for the audit record.
+	RemovedKeys []string `json:"removed_keys,omitempty"`
+	// NextAttemptAt is set while a failed task is waiting out its retry backoff.
+	NextAttemptAt int64 `json:"next_attempt_at,omitempty"`
+}
+
+// AuditRecord documents a completed cleanup, or one that ran out of attempts.
+type AuditRecord struct {
+	ID      string        `json:"id"`
+	PostID  string        `json:"post_id"`
+	FileIDs []string      `json:"file_ids"`
+	Reason  CleanupReason `json:"reason"`
+	// RemovedKeys lists the artifacts that were deleted from the artifact store.
+	RemovedKeys []string `json:"removed_keys"`
+	Attempts    int      `json:"attempts"`
+	RequestedAt int64    `json:"requested_at"`
+	CompletedAt int64    `json:"completed_at"`
+	// Error is set when the cleanup was dead-lettered after its last attempt failed; the
+	// artifacts missing from RemovedKeys may have been left behind.
+	Error string `json:"error,omitempty"`
+}
+
+func (kv Client) SaveCleanupTask(task *CleanupTask) error {
+	if _, err := kv.client.KV.Set(cleanupKeyPrefix+task.ID, task); err != nil {
+		return errors.Wrapf(err, "failed to save cleanup task %s", task.ID)
+	}
+	return nil
+}
+
+func (kv Client) GetCleanupTask(taskID string) (*CleanupTask, error) {
+	var task *CleanupTask
+	if err := kv.client.KV.Get(cleanupKeyPrefix+taskID, &task); err != nil {
+		return nil, errors.Wrapf(err, "failed to get cleanup task %s", taskID)
+	}
+	return task, nil
+}
+
+func (kv Client) DeleteCleanupTask(taskID string) error {
+	if err := kv.client.KV.Delete(cleanupKeyPrefix + taskID); err != nil {
+		return errors.Wrapf(err, "failed to delete cleanup task %s", taskID)
+	}
+	return nil
+}
+
+func (kv Client) ListCleanupTasks() ([]*CleanupTask, error) {
+	keys, err := kv.listKeysWithPrefix(cleanupKeyPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list cleanup tasks")
+	}
+
+	tasks := make([]*CleanupTask, 0, len(keys))
+	for _, key := range keys {
+		task, err := kv.GetCleanupTask(strings.TrimPrefix(key, cleanupKeyPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if task != nil {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+func (kv Client) AddAuditRecord(record *AuditRecord) error {
+	if _, err := kv.client.KV.Set(auditKeyPrefix+record.ID, record); err != nil {
+		return errors.Wrapf(err, "failed to save audit record %s", record.ID)
+	}
+	return nil
+}
+
+func (kv Client) DeleteAuditRecord(recordID string) error {
+	if err := kv.client.KV.Delete(auditKeyPrefix + recordID); err != nil {
+		return errors.Wrapf(err, "failed to delete audit record %s", recordID)
+	}
+	return nil
+}
+
+func (kv Client) ListAuditRecords() ([]*AuditRecord, error) {
+	keys, err := kv.listKeysWithPrefix(auditKeyPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list audit records")
+	}
+
+	records := make([]*AuditRecord, 0, len(keys))
+	for _, key := range keys {
+		var record *AuditRecord
+		if err := kv.client.KV.Get(key, &record); err != nil {
+			return nil, errors.Wrapf(err, "failed to get audit record %s", strings.TrimPrefix(key, auditKeyPrefix))
+		}
+		if record != nil {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
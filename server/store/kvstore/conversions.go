@@ -0,0 +1,60 @@
+package kvstore
+
+import (
+	"github.com/pkg/errors"
+)
+
+const conversionKeyPrefix = "conversion-"
+
+// ConversionState is the user-facing state of a file's conversion.
+type ConversionState string
+
+const (
+	ConversionStateQueued    ConversionState = "queued"
+	ConversionStateRunning   ConversionState = "running"
+	ConversionStateSucceeded ConversionState = "succeeded"
+	ConversionStateFailed    ConversionState = "failed"
+	// ConversionStateExpired is the tombstone left once the artifact outlived the retention
+	// period, so that reconciliation does not convert the file again. A retry still does.
+	ConversionStateExpired ConversionState = "expired"
+)
+
+// ConversionStatus is the latest known conversion outcome of an attachment.
+type ConversionStatus struct {
+	FileID    string          `json:"file_id"`
+	PostID    string          `json:"post_id"`
+	ChannelID string          `json:"channel_id"`
+	JobID     string          `json:"job_id"`
+	State     ConversionState `json:"state"`
+	Converter string          `json:"converter,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	// ArtifactKey locates the published artifact in the configured artifact store.
+	ArtifactKey string `json:"artifact_key,omitempty"`
+	// Format is the artifact's file extension without the dot, telling the viewer how to open it.
+	Format     string `json:"format,omitempty"`
+	CacheHit   bool   `json:"cache_hit,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	UpdatedAt  int64  `json:"updated_at"`
+}
+
+func (kv Client) SaveConversionStatus(status *ConversionStatus) error {
+	if _, err := kv.client.KV.Set(conversionKeyPrefix+status.FileID, status); err != nil {
+		return errors.Wrapf(err, "failed to save conversion status of file %s", status.FileID)
+	}
+	return nil
+}
+
+func (kv Client) GetConversionStatus(fileID string) (*ConversionStatus, error) {
+	var status *ConversionStatus
+	if err := kv.client.KV.Get(conversionKeyPrefix+fileID, &status); err != nil {
+		return nil, errors.Wrapf(err, "failed to get conversion status of file %s", fileID)
+	}
+	return status, nil
+}
+
+func (kv Client) DeleteConversionStatus(fileID string) error {
+	if err := kv.client.KV.Delete(conversionKeyPrefix + fileID); err != nil {
+		return errors.Wrapf(err, "failed to delete conversion status of file %s", fileID)
+	}
+	return nil
+}
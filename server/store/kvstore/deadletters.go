@@ -0,0 +1,61 @@
+package kvstore
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const deadLetterKeyPrefix = "deadletter-"
+
+// DeadLetter is a conversion job that failed permanently or ran out of attempts.
+type DeadLetter struct {
+	JobID     string `json:"job_id"`
+	PostID    string `json:"post_id"`
+	ChannelID string `json:"channel_id"`
+	FileID    string `json:"file_id"`
+	Attempts  int    `json:"attempts"`
+	Reason    string `json:"reason"`
+	FailedAt  int64  `json:"failed_at"`
+}
+
+func (kv Client) AddDeadLetter(entry *DeadLetter) error {
+	if _, err := kv.client.KV.Set(deadLetterKeyPrefix+entry.JobID, entry); err != nil {
+		return errors.Wrapf(err, "failed to save dead letter %s", entry.JobID)
+	}
+	return nil
+}
+
+func (kv Client) GetDeadLetter(jobID string) (*DeadLetter, error) {
+	var entry *DeadLetter
+	if err := kv.client.KV.Get(deadLetterKeyPrefix+jobID, &entry); err != nil {
+		return nil, errors.Wrapf(err, "failed to get dead letter %s", jobID)
+	}
+	return entry, nil
+}
+
+func (kv Client) DeleteDeadLetter(jobID string) error {
+	if err := kv.client.KV.Delete(deadLetterKeyPrefix + jobID); err != nil {
+		return errors.Wrapf(err, "failed to delete dead letter %s", jobID)
+	}
+	return nil
+}
+
+func (kv Client) ListDeadLetters() ([]*DeadLetter, error) {
+	keys, err := kv.listKeysWithPrefix(deadLetterKeyPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list dead letters")
+	}
+
+	entries := make([]*DeadLetter, 0, len(keys))
+	for _, key := range keys {
+		entry, err := kv.GetDeadLetter(strings.TrimPrefix(key, deadLetterKeyPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,108 @@
+package kvstore
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	jobKeyPrefix = "job-"
+
+	// listKeysPerPage is the page size used when walking the KV store keys.
+	listKeysPerPage = 1000
+)
+
+// JobState describes where a conversion job is in its lifecycle.
+type JobState string
+
+const (
+	JobStatePending   JobState = "pending"
+	JobStateRunning   JobState = "running"
+	JobStateSucceeded JobState = "succeeded"
+	JobStateFailed    JobState = "failed"
+	// JobStateCanceled jobs were dropped because their file left its post before the artifact
+	// was published.
+	JobStateCanceled JobState = "canceled"
+)
+
+// Job is a single attachment conversion persisted so that it survives plugin restarts.
+type Job struct {
+	ID        string   `json:"id"`
+	PostID    string   `json:"post_id"`
+	ChannelID string   `json:"channel_id"`
+	FileID    string   `json:"file_id"`
+	State     JobState `json:"state"`
+	Attempts  int      `json:"attempts"`
+	LastError string   `json:"last_error,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+	UpdatedAt int64    `json:"updated_at"`
+	// NextAttemptAt is set while a failed job is waiting out its retry backoff.
+	NextAttemptAt int64 `json:"next_attempt_at,omitempty"`
+}
+
+// IsFinished reports whether the job reached a terminal state.
+func (j *Job) IsFinished() bool {
+	return j.State == JobStateSucceeded || j.State == JobStateFailed || j.State == JobStateCanceled
+}
+
+func (kv Client) SaveJob(job *Job) error {
+	if _, err := kv.client.KV.Set(jobKeyPrefix+job.ID, job); err != nil {
+		return errors.Wrapf(err, "failed to save job %s", job.ID)
+	}
+	return nil
+}
+
+func (kv Client) GetJob(jobID string) (*Job, error) {
+	var job *Job
+	if err := kv.client.KV.Get(jobKeyPrefix+jobID, &job); err != nil {
+		return nil, errors.Wrapf(err, "failed to get job %s", jobID)
+	}
+	return job, nil
+}
+
+func (kv Client) DeleteJob(jobID string) error {
+	if err := kv.client.KV.Delete(jobKeyPrefix + jobID); err != nil {
+		return errors.Wrapf(err, "failed to delete job %s", jobID)
+	}
+	return nil
+}
+
+func (kv Client) ListJobs() ([]*Job, error) {
+	keys, err := kv.listKeysWithPrefix(jobKeyPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list jobs")
+	}
+
+	jobs := make([]*Job, 0, len(keys))
+	for _, key := range keys {
+		job, err := kv.GetJob(strings.TrimPrefix(key, jobKeyPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if job != nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// listKeysWithPrefix walks every page of the plugin's keys. pluginapi's WithPrefix option filters
+// after paginating, so an empty filtered page does not mean the end of the list.
+func (kv Client) listKeysWithPrefix(prefix string) ([]string, error) {
+	var matched []string
+	for page := 0; ; page++ {
+		keys, err := kv.client.KV.ListKeys(page, listKeysPerPage)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if strings.HasPrefix(key, prefix) {
+				matched = append(matched, key)
+			}
+		}
+		if len(keys) < listKeysPerPage {
+			return matched, nil
+		}
+	}
+}
@@ -3,4 +3,90 @@ package kvstore
 type KVStore interface {
 	// Define your methods here. This package is used to access the KVStore pluginapi methods.
 	GetTemplateData(userID string) (string, error)
+
+	// SaveJob creates or replaces the conversion job record.
+	SaveJob(job *Job) error
+	// GetJob returns the conversion job with the given ID, or nil if it does not exist.
+	GetJob(jobID string) (*Job, error)
+	// DeleteJob removes the conversion job record.
+	DeleteJob(jobID string) error
+	// ListJobs returns every stored conversion job.
+	ListJobs() ([]*Job, error)
+
+	// AddDeadLetter records a job that exhausted its retries.
+	AddDeadLetter(entry *DeadLetter) error
+	// GetDeadLetter returns the dead-letter entry for the job, or nil if there is none.
+	GetDeadLetter(jobID string) (*DeadLetter, error)
+	// DeleteDeadLetter removes the job from the dead-letter list.
+	DeleteDeadLetter(jobID string) error
+	// ListDeadLetters returns every dead-lettered job.
+	ListDeadLetters() ([]*DeadLetter, error)
+
+	// SaveConversionStatus replaces the conversion status of a file.
+	SaveConversionStatus(status *ConversionStatus) error
+	// GetConversionStatus returns the conversion status of a file, or nil if it was never queued.
+	GetConversionStatus(fileID string) (*ConversionStatus, error)
+	// DeleteConversionStatus removes the conversion status of a file.
+	DeleteConversionStatus(fileID string) error
+
+	// SaveArtifact records where the artifact of a file was published.
+	SaveArtifact(artifact *Artifact) error
+	// GetArtifact returns the manifest entry of a file, or nil if it has no artifact.
+	GetArtifact(fileID string) (*Artifact, error)
+	// DeleteArtifact removes the manifest entry of a file.
+	DeleteArtifact(fileID string) error
+	// ListArtifacts returns every manifest entry.
+	ListArtifacts() ([]*Artifact, error)
+
+	// SaveCacheEntry records the artifact converted from some content.
+	SaveCacheEntry(entry *CacheEntry) error
+	// GetCacheEntry returns the cached artifact of the content for the converter version, or nil.
+	GetCacheEntry(contentHash, converter, version string) (*CacheEntry, error)
+	// DeleteCacheEntry forgets the cached artifact of the content for the converter version.
+	DeleteCacheEntry(contentHash, converter, version string) error
+	// ListCacheEntries returns every conversion cache entry.
+	ListCacheEntries() ([]*CacheEntry, error)
+	// RecordCacheLookup counts a conversion cache hit or miss.
+	RecordCacheLookup(hit bool) error
+	// GetCacheStats returns the conversion cache hit and miss counters.
+	GetCacheStats() (*CacheStats, error)
+
+	// SaveCleanupTask creates or replaces a pending artifact cleanup.
+	SaveCleanupTask(task *CleanupTask) error
+	// GetCleanupTask returns the cleanup task with the given ID, or nil if it completed.
+	GetCleanupTask(taskID string) (*CleanupTask, error)
+	// DeleteCleanupTask removes a completed cleanup task.
+	DeleteCleanupTask(taskID string) error
+	// ListCleanupTasks returns every pending cleanup task.
+	ListCleanupTasks() ([]*CleanupTask, error)
+
+	// AddAuditRecord records a completed or dead-lettered cleanup.
+	AddAuditRecord(record *AuditRecord) error
+	// DeleteAuditRecord removes a cleanup audit record.
+	DeleteAuditRecord(recordID string) error
+	// ListAuditRecords returns every cleanup audit record.
+	ListAuditRecords() ([]*AuditRecord, error)
+
+	// SaveMaintenanceReport replaces the report of the last maintenance sweep.
+	SaveMaintenanceReport(report *MaintenanceReport) error
+	// GetMaintenanceReport returns the report of the last maintenance sweep, or nil if none ran yet.
+	GetMaintenanceReport() (*MaintenanceReport, error)
+
+	// SaveBackfill creates or replaces a backfill and its checkpoint.
+	SaveBackfill(backfill *Backfill) error
+	// SaveBackfillCheckpoint saves the progress of a running backfill unless it was canceled or
+	// removed meanwhile, and reports whether it was saved.
+	SaveBackfillCheckpoint(backfill *Backfill) (bool, error)
+	// GetBackfill returns the backfill with the given ID, or nil if it does not exist.
+	GetBackfill(backfillID string) (*Backfill, error)
+	// ListBackfills returns every backfill, running or finished.
+	ListBackfills() ([]*Backfill, error)
+
+	// GetViewerTokenSecret returns the cluster-wide secret signing viewer tokens.
+	GetViewerTokenSecret() (string, error)
+	// SaveViewerLink records a one-time viewer link until it expires.
+	SaveViewerLink(link *ViewerLink) error
+	// ConsumeViewerLink returns the viewer link with the given nonce and deletes it, or nil if it
+	// does not exist, expired or was already used.
+	ConsumeViewerLink(nonce string) (*ViewerLink, error)
 }
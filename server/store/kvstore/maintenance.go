@@ -0,0 +1,41 @@
+package kvstore
+
+import (
+	"github.com/pkg/errors"
+)
+
+const maintenanceReportKey = "maintenancereport"
+
+// MaintenanceReport summarizes what a maintenance sweep reclaimed.
+type MaintenanceReport struct {
+	StartedAt  int64 `json:"started_at"`
+	FinishedAt int64 `json:"finished_at"`
+	// ExpiredArtifacts counts the artifacts deleted because they outlived the retention period.
+	ExpiredArtifacts int `json:"expired_artifacts"`
+	// OrphanedArtifacts counts the artifacts deleted because their post no longer exists.
+	OrphanedArtifacts int `json:"orphaned_artifacts"`
+	// StaleTempFiles counts the leftovers of interrupted conversions and uploads.
+	StaleTempFiles int `json:"stale_temp_files"`
+	// CompactedJobs counts the finished job records removed from the KV store.
+	CompactedJobs int `json:"compacted_jobs"`
+	// PrunedAuditRecords counts the cleanup audit records removed after the audit retention.
+	PrunedAuditRecords int   `json:"pruned_audit_records"`
+	ReclaimedBytes     int64 `json:"reclaimed_bytes"`
+	// Errors lists the steps that failed; the sweep carries on with the next one.
+	Errors []string `json:"errors,omitempty"`
+}
+
+func (kv Client) SaveMaintenanceReport(report *MaintenanceReport) error {
+	if _, err := kv.client.KV.Set(maintenanceReportKey, report); err != nil {
+		return errors.Wrap(err, "failed to save maintenance report")
+	}
+	return nil
+}
+
+func (kv Client) GetMaintenanceReport() (*MaintenanceReport, error) {
+	var report *MaintenanceReport
+	if err := kv.client.KV.Get(maintenanceReportKey, &report); err != nil {
+		return nil, errors.Wrap(err, "failed to get maintenance report")
+	}
+	return report, nil
+}
@@ -0,0 +1,48 @@
+package kvstore
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+	"github.com/pkg/errors"
+)
+
+const (
+	viewerTokenSecretKey = "viewer_token_secret"
+
+	// generatedSecretBytes is the amount of entropy in a generated secret.
+	generatedSecretBytes = 32
+)
+
+// GetViewerTokenSecret returns the secret signing viewer tokens, generating it on first use.
+// The secret is shared through the KV store so every node of a cluster signs with the same key.
+func (kv Client) GetViewerTokenSecret() (string, error) {
+	var secret string
+	if err := kv.client.KV.Get(viewerTokenSecretKey, &secret); err != nil {
+		return "", errors.Wrap(err, "failed to get viewer token secret")
+	}
+	if secret != "" {
+		return secret, nil
+	}
+
+	raw := make([]byte, generatedSecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", errors.Wrap(err, "failed to generate viewer token secret")
+	}
+	generated := base64.RawURLEncoding.EncodeToString(raw)
+
+	saved, err := kv.client.KV.Set(viewerTokenSecretKey, generated, pluginapi.SetAtomic(nil))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to save viewer token secret")
+	}
+	if saved {
+		return generated, nil
+	}
+
+	// Another node generated the secret first.
+	if err := kv.client.KV.Get(viewerTokenSecretKey, &secret); err != nil {
+		return "", errors.Wrap(err, "failed to get viewer token secret")
+	}
+	return secret, nil
+}
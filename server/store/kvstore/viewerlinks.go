@@ -0,0 +1,54 @@
+package kvstore
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+	"github.com/pkg/errors"
+)
+
+const viewerLinkKeyPrefix = "viewerlink-"
+
+// ViewerLink is a one-time link opening a converted file for a user. The link only carries its
+// nonce; the viewer token is minted when the link is followed, so that it never appears in a URL.
+type ViewerLink struct {
+	Nonce     string `json:"nonce"`
+	UserID    string `json:"user_id"`
+	FileID    string `json:"file_id"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func (kv Client) SaveViewerLink(link *ViewerLink) error {
+	ttl := time.Until(time.UnixMilli(link.ExpiresAt))
+	if _, err := kv.client.KV.Set(viewerLinkKeyPrefix+link.Nonce, link, pluginapi.SetExpiry(ttl)); err != nil {
+		return errors.Wrap(err, "failed to save viewer link")
+	}
+	return nil
+}
+
+func (kv Client) ConsumeViewerLink(nonce string) (*ViewerLink, error) {
+	key := viewerLinkKeyPrefix + nonce
+	var raw []byte
+	if err := kv.client.KV.Get(key, &raw); err != nil {
+		return nil, errors.Wrap(err, "failed to get viewer link")
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	// Only the request that deletes the link gets to use it.
+	deleted, err := kv.client.KV.Set(key, nil, pluginapi.SetAtomic(raw))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to delete viewer link")
+	}
+	if !deleted {
+		return nil, nil
+	}
+
+	var link *ViewerLink
+	if err := json.Unmarshal(raw, &link); err != nil {
+		return nil, errors.Wrap(err, "failed to decode viewer link")
+	}
+	return link, nil
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+
+	"github.com/jyoonje/collabview_plugin/server/store/artifactstore"
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+	"github.com/jyoonje/collabview_plugin/server/viewertoken"
+)
+
+// viewerTokenResponse is everything the webapp needs to open a document in Collabview.
+type viewerTokenResponse struct {
+	ViewerURL string `json:"viewer_url"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+	UserID    string `json:"user_id"`
+	UserName  string `json:"user_name"`
+	FileID    string `json:"file_id"`
+	PostID    string `json:"post_id"`
+	FilePath  string `json:"file_path"`
+	Authority int    `json:"authority"`
+}
+
+// viewerTokenSecret returns the configured signing secret, or the one generated in the KV store.
+func (p *Plugin) viewerTokenSecret(cfg *activeConfig) ([]byte, error) {
+	if cfg.ViewerTokenSecret != "" {
+		return []byte(cfg.ViewerTokenSecret), nil
+	}
+	secret, err := p.kvstore.GetViewerTokenSecret()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(secret), nil
+}
+
+// errNotConverted is returned when a viewer token is requested for a file without an artifact.
+var errNotConverted = errors.New("file has not been converted")
+
+// CreateViewerTokenHandler mints a short-lived token allowing the user to open the converted
+// file in Collabview. Read access to the file is enforced by FileReadPermissionRequired.
+func (p *Plugin) CreateViewerTokenHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := p.snapshot()
+	if cfg == nil {
+		http.Error(w, "Plugin is not active", http.StatusServiceUnavailable)
+		return
+	}
+	userID := r.Header.Get("Mattermost-User-ID")
+	fileID := r.URL.Query().Get("fileID")
+
+	response, err := p.issueViewerToken(cfg, userID, fileID)
+	if errors.Is(err, errNotConverted) {
+		http.Error(w, "File has not been converted", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		p.client.Log.Error("Error issuing viewer token", "fileID", fileID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.client.Log.Error("Error encoding viewer token", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// issueViewerToken signs a viewer token for the user and the converted file. Callers must
+// have checked that the user can read the file.
+func (p *Plugin) issueViewerToken(cfg *activeConfig, userID, fileID string) (*viewerTokenResponse, error) {
+	status, err := p.convertedStatus(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get user %s", userID)
+	}
+
+	authority := viewertoken.AuthorityView
+	if post, appErr := p.API.GetPost(status.PostID); appErr == nil &&
+		p.API.HasPermissionToChannel(userID, post.ChannelId, model.PermissionCreatePost) {
+		authority = viewertoken.AuthorityAnnotate
+	}
+
+	filePath, err := p.viewerFilePath(cfg, status.ArtifactKey)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &viewertoken.Claims{
+		UserID:     userID,
+		UserName:   user.GetDisplayName(model.ShowNicknameFullName),
+		FileID:     fileID,
+		PostID:     status.PostID,
+		OutputPath: filePath,
+		Authority:  authority,
+		ExpiresAt:  time.Now().Add(cfg.ViewerTokenTTL()).UnixMilli(),
+	}
+
+	secret, err := p.viewerTokenSecret(cfg)
+	if err != nil {
+		return nil, err
+	}
+	token, err := viewertoken.Sign(claims, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &viewerTokenResponse{
+		ViewerURL: cfg.ViewerURL,
+		Token:     token,
+		ExpiresAt: claims.ExpiresAt,
+		UserID:    claims.UserID,
+		UserName:  claims.UserName,
+		FileID:    claims.FileID,
+		PostID:    claims.PostID,
+		FilePath:  claims.OutputPath,
+		Authority: claims.Authority,
+	}, nil
+}
+
+// viewerFilePath returns where Collabview reads the artifact from. Artifacts of the local store
+// are on the filesystem Collabview shares with the server; the other stores are only reachable
+// by the plugin, which streams their artifacts from ViewerArtifactHandler.
+func (p *Plugin) viewerFilePath(cfg *activeConfig, artifactKey string) (string, error) {
+	if cfg.ArtifactStore == artifactstore.LocalStoreName {
+		return cfg.ViewerFilePath(artifactKey), nil
+	}
+	pluginURL, err := p.pluginURL()
+	if err != nil {
+		return "", err
+	}
+	return pluginURL + "/api/v1/viewer/artifact", nil
+}
+
+// pluginURL returns the absolute URL the plugin's HTTP routes are served under.
+func (p *Plugin) pluginURL() (string, error) {
+	siteURL := p.API.GetConfig().ServiceSettings.SiteURL
+	if siteURL == nil || *siteURL == "" {
+		return "", errors.New("the Mattermost site URL is not configured")
+	}
+	return fmt.Sprintf("%s/plugins/%s", strings.TrimSuffix(*siteURL, "/"), manifest.Id), nil
+}
+
+// convertedStatus returns the conversion status of a file that has an artifact to open.
+func (p *Plugin) convertedStatus(fileID string) (*kvstore.ConversionStatus, error) {
+	status, err := p.kvstore.GetConversionStatus(fileID)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil || status.State != kvstore.ConversionStateSucceeded || status.ArtifactKey == "" {
+		return nil, errNotConverted
+	}
+	return status, nil
+}
+
+// ViewerLink implements command.ConversionService. The link carries a one-time nonce that
+// OpenViewerHandler exchanges for a viewer token, which it submits to Collabview the way the
+// webapp does. Links end up in chat history and browser history, so they hold no credential of
+// their own once used or expired.
+func (p *Plugin) ViewerLink(userID, fileID string) (string, error) {
+	cfg := p.snapshot()
+	if cfg == nil {
+		return "", errors.New("plugin is not active")
+	}
+	if cfg.ViewerURL == "" {
+		return "", errors.New("the Collabview viewer URL is not configured")
+	}
+	pluginURL, err := p.pluginURL()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := p.convertedStatus(fileID); err != nil {
+		return "", err
+	}
+
+	link := &kvstore.ViewerLink{
+		Nonce:     model.NewRandomString(viewerLinkNonceLength),
+		UserID:    userID,
+		FileID:    fileID,
+		ExpiresAt: time.Now().Add(cfg.ViewerTokenTTL()).UnixMilli(),
+	}
+	if err := p.kvstore.SaveViewerLink(link); err != nil {
+		return "", err
+	}
+	return pluginURL + "/api/v1/viewer/open?nonce=" + url.QueryEscape(link.Nonce), nil
+}
+
+// viewerLinkNonceLength is the length of the random, base32 nonce of a viewer link.
+const viewerLinkNonceLength = 32
+
+// openViewerPage posts the viewer token to Collabview, as the webapp's openViewer does.
+var openViewerPage = template.Must(template.New("open").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Collabview</title></head>
+<body onload="document.forms[0].submit()">
+<form method="POST" action="{{.ViewerURL}}">
+{{range $name, $value := .Fields}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<button type="submit">Open in Collabview</button>
+</form>
+</body>
+</html>
+`))
+
+// OpenViewerHandler serves the links handed out by /collabview open. Like the verify endpoint it
+// is reached without a Mattermost session: the one-time nonce is the credential. It is consumed
+// here and exchanged for a viewer token, which is only sent in the body of the page.
+func (p *Plugin) OpenViewerHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := p.snapshot()
+	if cfg == nil {
+		http.Error(w, "Plugin is not active", http.StatusServiceUnavailable)
+		return
+	}
+	nonce := r.URL.Query().Get("nonce")
+	if nonce == "" {
+		http.Error(w, "Missing nonce", http.StatusBadRequest)
+		return
+	}
+
+	link, err := p.kvstore.ConsumeViewerLink(nonce)
+	if err != nil {
+		p.client.Log.Error("Error consuming viewer link", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if link == nil || time.Now().UnixMilli() > link.ExpiresAt {
+		http.Error(w, "The link is invalid, expired or was already used", http.StatusUnauthorized)
+		return
+	}
+	// Access may have been revoked since the link was handed out.
+	if allowed, _ := p.canReadFile(link.UserID, link.FileID); !allowed {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	response, err := p.issueViewerToken(cfg, link.UserID, link.FileID)
+	if errors.Is(err, errNotConverted) {
+		http.Error(w, "File has not been converted", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		p.client.Log.Error("Error issuing viewer token", "fileID", link.FileID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := struct {
+		ViewerURL string
+		Fields    map[string]string
+	}{
+		ViewerURL: response.ViewerURL,
+		Fields: map[string]string{
+			"authority": strconv.Itoa(response.Authority),
+			"userName":  response.UserName,
+			"userID":    response.UserID,
+			"objectID":  response.FileID,
+			"filePath":  response.FilePath,
+			"token":     response.Token,
+		},
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := openViewerPage.Execute(w, page); err != nil {
+		p.client.Log.Error("Error rendering viewer page", "error", err)
+	}
+}
+
+// VerifyViewerTokenHandler is called by the Collabview viewer, without a Mattermost session,
+// to check a token before opening a document. It answers with the token's claims when the
+// signature is valid, the token has not expired and the user can still read the file.
+func (p *Plugin) VerifyViewerTokenHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := p.snapshot()
+	if cfg == nil {
+		http.Error(w, "Plugin is not active", http.StatusServiceUnavailable)
+		return
+	}
+	token := r.FormValue("token")
+	if token == "" {
+		http.Error(w, "Missing token", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := p.viewerTokenSecret(cfg)
+	if err != nil {
+		p.client.Log.Error("Error getting viewer token secret", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	claims, err := viewertoken.Verify(token, secret, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Access may have been revoked since the token was minted.
+	if allowed, _ := p.canReadFile(claims.UserID, claims.FileID); !allowed {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(claims); err != nil {
+		p.client.Log.Error("Error encoding viewer token claims", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ViewerArtifactHandler streams the artifact of a file to Collabview, which cannot read the
+// filestore and s3 stores itself. Like the verify endpoint it is reached without a Mattermost
+// session; the viewer token, sent as "Authorization: Bearer <token>" so that it stays out of
+// URLs and access logs, is the credential.
+func (p *Plugin) ViewerArtifactHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := p.snapshot()
+	if cfg == nil {
+		http.Error(w, "Plugin is not active", http.StatusServiceUnavailable)
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		http.Error(w, "Missing token", http.StatusUnauthorized)
+		return
+	}
+
+	secret, err := p.viewerTokenSecret(cfg)
+	if err != nil {
+		p.client.Log.Error("Error getting viewer token secret", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	claims, err := viewertoken.Verify(token, secret, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if allowed, status := p.canReadFile(claims.UserID, claims.FileID); !allowed {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	status, err := p.convertedStatus(claims.FileID)
+	if errors.Is(err, errNotConverted) {
+		http.Error(w, "File has not been converted", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		p.client.Log.Error("Error getting conversion status", "fileID", claims.FileID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fail := func(err error) {
+		if errors.Is(err, artifactstore.ErrNotFound) {
+			http.Error(w, "Artifact not found", http.StatusNotFound)
+			return
+		}
+		p.client.Log.Error("Error reading artifact", "fileID", claims.FileID, "key", status.ArtifactKey, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	info, err := cfg.artifacts.Stat(r.Context(), status.ArtifactKey)
+	if err != nil {
+		fail(err)
+		return
+	}
+	artifact, err := cfg.artifacts.Get(r.Context(), status.ArtifactKey)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer artifact.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(status.ArtifactKey)}))
+	w.Header().Set("Cache-Control", "private, no-store")
+	if _, err := io.Copy(w, artifact); err != nil {
+		p.client.Log.Warn("Error streaming artifact", "fileID", claims.FileID, "error", err)
+	}
+}
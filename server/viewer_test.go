@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jyoonje/collabview_plugin/server/store/artifactstore"
+	"github.com/jyoonje/collabview_plugin/server/store/kvstore"
+	"github.com/jyoonje/collabview_plugin/server/viewertoken"
+)
+
+func TestViewerLink(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	cfg := p.snapshot()
+	cfg.ViewerURL = "https://collabview.example.com/cv_call"
+	cfg.ViewerTokenSecret = "secret"
+	cfg.ViewerTokenTTLSeconds = 300
+
+	kvMemory(api, map[string][]byte{})
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://chat.example.com/")}})
+	api.On("GetFileInfo", "file").Return(&model.FileInfo{Id: "file", PostId: "post"}, nil)
+	api.On("GetPost", "post").Return(&model.Post{Id: "post", ChannelId: "channel"}, nil)
+	api.On("HasPermissionToChannel", "user", "channel", mock.Anything).Return(true)
+	api.On("GetUser", "user").Return(&model.User{Id: "user", Username: "user"}, nil)
+	require.NoError(t, p.kvstore.SaveConversionStatus(&kvstore.ConversionStatus{FileID: "file", PostID: "post", State: kvstore.ConversionStateSucceeded, ArtifactKey: "post/file/plan.esob"}))
+
+	_, err := p.ViewerLink("user", "unconverted")
+	assert.ErrorIs(t, err, errNotConverted)
+
+	link, err := p.ViewerLink("user", "file")
+	require.NoError(t, err)
+	parsed, err := url.Parse(link)
+	require.NoError(t, err)
+	assert.Equal(t, "/plugins/"+manifest.Id+"/api/v1/viewer/open", parsed.Path)
+	assert.NotContains(t, parsed.Query(), "token", "no viewer token is put in the URL")
+
+	open := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		p.OpenViewerHandler(w, httptest.NewRequest(http.MethodGet, parsed.RequestURI(), nil))
+		return w
+	}
+
+	w := open()
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	body := w.Body.String()
+	assert.Contains(t, body, `action="https://collabview.example.com/cv_call"`)
+	_, token, found := strings.Cut(body, `name="token" value="`)
+	require.True(t, found)
+	token, _, _ = strings.Cut(token, `"`)
+	claims, err := viewertoken.Verify(token, []byte("secret"), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "user", claims.UserID)
+	assert.Equal(t, "file", claims.FileID)
+
+	assert.Equal(t, http.StatusUnauthorized, open().Code, "a link works once")
+}
+
+func TestOpenViewerHandlerWhileInactive(t *testing.T) {
+	p, _, _ := newTestPlugin(t)
+	p.active.Store(nil)
+
+	w := httptest.NewRecorder()
+	p.OpenViewerHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/viewer/open?nonce=abc", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestViewerArtifactHandler(t *testing.T) {
+	p, api, store := newTestPlugin(t)
+	cfg := p.snapshot()
+	cfg.ArtifactStore = artifactstore.FileStoreName
+	cfg.ViewerTokenSecret = "secret"
+	cfg.ViewerTokenTTLSeconds = 300
+
+	kvMemory(api, map[string][]byte{})
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://chat.example.com")}})
+	api.On("GetFileInfo", "file").Return(&model.FileInfo{Id: "file", PostId: "post"}, nil)
+	api.On("GetPost", "post").Return(&model.Post{Id: "post", ChannelId: "channel"}, nil)
+	api.On("HasPermissionToChannel", "user", "channel", model.PermissionReadChannel).Return(true)
+	api.On("HasPermissionToChannel", "user", "channel", model.PermissionCreatePost).Return(false)
+	api.On("HasPermissionToChannel", "outsider", "channel", mock.Anything).Return(false)
+	api.On("GetUser", mock.Anything).Return(&model.User{Id: "user", Username: "user"}, nil)
+
+	require.NoError(t, store.Put(context.Background(), "post/file/plan.esob", strings.NewReader("artifact"), 8))
+	require.NoError(t, p.kvstore.SaveConversionStatus(&kvstore.ConversionStatus{FileID: "file", PostID: "post", State: kvstore.ConversionStateSucceeded, ArtifactKey: "post/file/plan.esob"}))
+
+	response, err := p.issueViewerToken(cfg, "user", "file")
+	require.NoError(t, err)
+	assert.Equal(t, "https://chat.example.com/plugins/"+manifest.Id+"/api/v1/viewer/artifact", response.FilePath, "stores Collabview cannot read are served by the plugin")
+
+	fetch := func(authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/viewer/artifact", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		p.ViewerArtifactHandler(w, r)
+		return w
+	}
+
+	w := fetch("Bearer " + response.Token)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "artifact", w.Body.String())
+	assert.Equal(t, "8", w.Header().Get("Content-Length"))
+
+	assert.Equal(t, http.StatusUnauthorized, fetch("").Code)
+	assert.Equal(t, http.StatusUnauthorized, fetch("Bearer "+response.Token+"x").Code)
+
+	outsider, err := p.issueViewerToken(cfg, "outsider", "file")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, fetch("Bearer "+outsider.Token).Code, "read access is checked again")
+}
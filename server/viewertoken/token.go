@@ -0,0 +1,86 @@
+package viewertoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrMalformed is returned for tokens that do not have the expected shape.
+	ErrMalformed = errors.New("malformed viewer token")
+	// ErrInvalidSignature is returned when the token was not signed with the shared secret.
+	ErrInvalidSignature = errors.New("invalid viewer token signature")
+	// ErrExpired is returned for tokens used after their expiry.
+	ErrExpired = errors.New("viewer token expired")
+)
+
+// Authority levels granted to the viewer.
+const (
+	AuthorityView     = 1
+	AuthorityAnnotate = 2
+)
+
+// Claims describe which document a user may open in the Collabview viewer.
+type Claims struct {
+	UserID     string `json:"user_id"`
+	UserName   string `json:"user_name"`
+	FileID     string `json:"file_id"`
+	PostID     string `json:"post_id"`
+	OutputPath string `json:"output_path"`
+	Authority  int    `json:"authority"`
+	ExpiresAt  int64  `json:"expires_at"`
+}
+
+// Sign serializes the claims and appends an HMAC-SHA256 signature, producing
+// "<base64url claims>.<base64url signature>".
+func Sign(claims *Claims, secret []byte) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode viewer token claims")
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(encoded, secret)), nil
+}
+
+// Verify checks the signature and expiry of the token and returns its claims.
+func Verify(token string, secret []byte, now time.Time) (*Claims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	decodedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if !hmac.Equal(decodedSignature, sign(encoded, secret)) {
+		return nil, ErrInvalidSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformed
+	}
+
+	if now.UnixMilli() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+func sign(encoded string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,57 @@
+package viewertoken
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	claims := &Claims{
+		UserID:     "user-id",
+		FileID:     "file-id",
+		PostID:     "post-id",
+		OutputPath: "output/post-id/plan.esob",
+		Authority:  AuthorityView,
+		ExpiresAt:  now.Add(time.Minute).UnixMilli(),
+	}
+
+	token, err := Sign(claims, secret)
+	require.NoError(t, err)
+
+	t.Run("valid", func(t *testing.T) {
+		verified, err := Verify(token, secret, now)
+		require.NoError(t, err)
+		assert.Equal(t, claims, verified)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		_, err := Verify(token, secret, now.Add(2*time.Minute))
+		assert.ErrorIs(t, err, ErrExpired)
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		_, err := Verify(token, []byte("other"), now)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("tampered claims", func(t *testing.T) {
+		forged, err := Sign(&Claims{UserID: "user-id", FileID: "other-file", ExpiresAt: claims.ExpiresAt}, []byte("other"))
+		require.NoError(t, err)
+		_, signature, _ := strings.Cut(token, ".")
+		payload, _, _ := strings.Cut(forged, ".")
+
+		_, err = Verify(payload+"."+signature, secret, now)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := Verify("not-a-token", secret, now)
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+}
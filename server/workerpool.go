@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// errQueueFull is returned by trySubmit when every slot of the queue is taken.
+var errQueueFull = errors.New("conversion queue is full")
+
+// errPoolClosed is returned when submitting to a pool that is shutting down.
+var errPoolClosed = errors.New("conversion pool is closed")
+
+// workerPool runs a resizable number of workers over a bounded queue of job IDs.
+type workerPool struct {
+	jobs    chan string
+	handler func(ctx context.Context, jobID string)
+	stop    chan struct{}
+	wg      sync.WaitGroup
+
+	// ctx is handed to every job and canceled when the pool closes.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	timersLock sync.Mutex
+	timers     map[string]*time.Timer
+
+	sizeLock sync.Mutex
+	// running is the number of live workers and target the number resize asked for.
+	running int
+	target  int
+	// resized is closed and replaced on every resize to wake idle workers up.
+	resized chan struct{}
+	// closed stops resize from starting workers the closing pool would not wait for.
+	closed bool
+}
+
+// newWorkerPool starts workers goroutines draining a queue of queueDepth job IDs.
+func newWorkerPool(workers, queueDepth int, handler func(ctx context.Context, jobID string)) *workerPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	wp := &workerPool{
+		ctx:     ctx,
+		cancel:  cancel,
+		jobs:    make(chan string, queueDepth),
+		handler: handler,
+		stop:    make(chan struct{}),
+		timers:  make(map[string]*time.Timer),
+		resized: make(chan struct{}),
+	}
+
+	wp.resize(workers)
+	return wp
+}
+
+// resize changes the number of workers. Extra workers are started right away; surplus workers
+// exit once they finish their current job, so running conversions are never interrupted.
+// Resizing a closed pool does nothing.
+func (wp *workerPool) resize(workers int) {
+	wp.sizeLock.Lock()
+	defer wp.sizeLock.Unlock()
+
+	if wp.closed {
+		return
+	}
+
+	wp.target = workers
+	for wp.running < wp.target {
+		wp.running++
+		wp.wg.Add(1)
+		go wp.work()
+	}
+
+	close(wp.resized)
+	wp.resized = make(chan struct{})
+}
+
+// retire reports whether the calling worker should exit to honor a smaller target size.
+func (wp *workerPool) retire() (bool, <-chan struct{}) {
+	wp.sizeLock.Lock()
+	defer wp.sizeLock.Unlock()
+
+	if wp.running > wp.target {
+		wp.running--
+		return true, nil
+	}
+	return false, wp.resized
+}
+
+func (wp *workerPool) work() {
+	defer wp.wg.Done()
+	for {
+		// Check stop first so a closing pool does not pick up more queued work.
+		select {
+		case <-wp.stop:
+			return
+		default:
+		}
+
+		retire, resized := wp.retire()
+		if retire {
+			return
+		}
+
+		select {
+		case <-wp.stop:
+			return
+		case <-resized:
+		case jobID := <-wp.jobs:
+			wp.handler(wp.ctx, jobID)
+		}
+	}
+}
+
+// trySubmit queues the job without blocking, rejecting it when the queue is full.
+func (wp *workerPool) trySubmit(jobID string) error {
+	select {
+	case <-wp.stop:
+		return errPoolClosed
+	default:
+	}
+
+	select {
+	case wp.jobs <- jobID:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// submit queues the job, blocking until there is room or the pool is closed.
+func (wp *workerPool) submit(jobID string) error {
+	select {
+	case <-wp.stop:
+		return errPoolClosed
+	default:
+	}
+
+	select {
+	case wp.jobs <- jobID:
+		return nil
+	case <-wp.stop:
+		return errPoolClosed
+	}
+}
+
+// submitAfter queues the job once delay has elapsed. Scheduling the same job again replaces
+// the previous timer.
+func (wp *workerPool) submitAfter(jobID string, delay time.Duration) {
+	wp.timersLock.Lock()
+	defer wp.timersLock.Unlock()
+
+	select {
+	case <-wp.stop:
+		// close already stopped the timers; this one would outlive the pool.
+		return
+	default:
+	}
+
+	if timer, ok := wp.timers[jobID]; ok {
+		timer.Stop()
+	}
+	wp.timers[jobID] = time.AfterFunc(delay, func() {
+		wp.timersLock.Lock()
+		delete(wp.timers, jobID)
+		wp.timersLock.Unlock()
+
+		_ = wp.submit(jobID)
+	})
+}
+
+// close cancels the running jobs and waits for their workers to return.
+// Jobs still waiting in the queue or on a retry timer are dropped; they remain pending in the KV store.
+func (wp *workerPool) close() {
+	wp.sizeLock.Lock()
+	wp.closed = true
+	wp.sizeLock.Unlock()
+
+	close(wp.stop)
+	wp.cancel()
+
+	wp.timersLock.Lock()
+	for jobID, timer := range wp.timers {
+		timer.Stop()
+		delete(wp.timers, jobID)
+	}
+	wp.timersLock.Unlock()
+
+	wp.wg.Wait()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPoolRejectsOverflow(t *testing.T) {
+	assert := assert.New(t)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	wp := newWorkerPool(1, 1, func(_ context.Context, jobID string) {
+		started <- struct{}{}
+		<-release
+	})
+
+	assert.Nil(wp.trySubmit("running"))
+	<-started
+	assert.Nil(wp.trySubmit("queued"))
+	assert.Equal(errQueueFull, wp.trySubmit("overflow"))
+
+	close(release)
+	wp.close()
+	assert.Equal(errPoolClosed, wp.trySubmit("late"))
+}
+
+func TestWorkerPoolRunsSubmittedJobs(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	handled := map[string]bool{}
+	wp := newWorkerPool(3, 10, func(_ context.Context, jobID string) {
+		mu.Lock()
+		handled[jobID] = true
+		mu.Unlock()
+		wg.Done()
+	})
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		assert.Nil(wp.submit(id))
+	}
+	wg.Wait()
+	wp.close()
+
+	assert.Len(handled, 4)
+}
+
+func TestWorkerPoolCloseCancelsRunningJobs(t *testing.T) {
+	assert := assert.New(t)
+
+	started := make(chan struct{})
+	var jobErr error
+	wp := newWorkerPool(1, 1, func(ctx context.Context, jobID string) {
+		close(started)
+		<-ctx.Done()
+		jobErr = ctx.Err()
+	})
+
+	assert.Nil(wp.submit("long"))
+	<-started
+	wp.close()
+
+	assert.Equal(context.Canceled, jobErr)
+}
+
+func TestWorkerPoolResize(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wp := newWorkerPool(1, 10, func(_ context.Context, jobID string) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		<-release
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		wg.Done()
+	})
+
+	wp.resize(3)
+	for _, id := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		assert.Nil(wp.submit(id))
+	}
+	assert.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return running == 3
+	}, time.Second, time.Millisecond)
+
+	wp.resize(1)
+	close(release)
+	wg.Wait()
+
+	assert.Eventually(func() bool {
+		wp.sizeLock.Lock()
+		defer wp.sizeLock.Unlock()
+		return wp.running == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(3, peak)
+
+	wp.close()
+}
+
+func TestWorkerPoolIgnoresCallsAfterClose(t *testing.T) {
+	assert := assert.New(t)
+
+	wp := newWorkerPool(1, 1, func(context.Context, string) {})
+	wp.close()
+
+	// A configuration change racing with deactivation must not start workers nobody waits for.
+	wp.resize(4)
+	wp.sizeLock.Lock()
+	assert.Equal(1, wp.running)
+	wp.sizeLock.Unlock()
+
+	wp.submitAfter("late", time.Millisecond)
+	wp.timersLock.Lock()
+	assert.Empty(wp.timers)
+	wp.timersLock.Unlock()
+}
@@ -1,7 +1,11 @@
 // Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
 // See LICENSE.txt for license information.
 
-import {useEffect, useCallback} from 'react';
+import React, {useEffect, useCallback, useState} from 'react';
+
+import type {ConversionStatus} from '../conversion_status';
+import {fetchConversionStatus, getConversionStatus, subscribeConversionStatus} from '../conversion_status';
+import {openViewer, requestViewerToken} from '../viewer';
 
 interface MyFileAttachmentProps {
     fileInfo: {
@@ -17,39 +21,55 @@ export default function MyFileAttachmentOverride(props: MyFileAttachmentProps) {
         if (props.fileInfo.extension === 'exe') {
             return;
         }
-        const url = 'http://192.168.0.244:3508/cv_call';
-        const params: Record<string, string> = {
-            authority: '1',
-            userName: 'ODM 업체',
-            userID: 'ODM',
-            objectID: '22000',
-            filePath: 'artwork/20241017/1234.jpg',
-        };
-
-        // 동적으로 form 요소 생성
-        const form = document.createElement('form');
-        form.method = 'POST';
-        form.action = url;
-
-        // 숨겨진 input 필드 생성 후 추가
-        for (const key in params) {
-            if (Object.prototype.hasOwnProperty.call(params, key)) {
-                const input = document.createElement('input');
-                input.type = 'hidden';
-                input.name = key;
-                input.value = params[key];
-                form.appendChild(input);
-            }
-        }
 
-        // 문서에 form 추가 후 제출
-        document.body.appendChild(form);
-        form.submit();
+        requestViewerToken(props.fileInfo.id).then(openViewer).catch((err) => {
+            // eslint-disable-next-line no-console
+            console.error('Collabview 뷰어 토큰 발급 실패', err);
+        });
     }, [props.fileInfo]);
 
+    const [status, setStatus] = useState<ConversionStatus | undefined>(getConversionStatus(props.fileInfo.id));
+    const [loaded, setLoaded] = useState(Boolean(status));
+
+    // 변환 상태 조회 및 WebSocket 업데이트 구독
+    useEffect(() => {
+        const unsubscribe = subscribeConversionStatus(props.fileInfo.id, setStatus);
+        fetchConversionStatus(props.fileInfo.id).then((fetched) => {
+            if (fetched) {
+                setStatus(fetched);
+            }
+            setLoaded(true);
+        });
+        return unsubscribe;
+    }, [props.fileInfo.id]);
+
+    // 변환이 끝난 파일만 뷰어로 이동
     useEffect(() => {
-        handleRedirect();
-    }, [handleRedirect]);
+        if (loaded && status?.state === 'succeeded') {
+            handleRedirect();
+        }
+    }, [loaded, status, handleRedirect]);
+
+    if (status?.state === 'queued' || status?.state === 'running') {
+        return (
+            <div className='collabview-conversion collabview-conversion--pending'>
+                <i className='fa fa-spinner fa-spin'/>
+                {status.state === 'queued' ? ' 변환 대기 중...' : ' 변환 중...'}
+            </div>
+        );
+    }
+
+    if (status?.state === 'failed') {
+        return (
+            <div
+                className='collabview-conversion collabview-conversion--failed'
+                title={status.error}
+            >
+                <i className='fa fa-exclamation-triangle'/>
+                {' 변환 실패'}
+            </div>
+        );
+    }
 
     return null;
 }
@@ -0,0 +1,93 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import manifest from '@/manifest';
+
+export type ConversionState = 'queued' | 'running' | 'succeeded' | 'failed' | 'expired';
+
+export interface ConversionStatus {
+    file_id: string;
+    post_id: string;
+    state: ConversionState;
+    stage?: string;
+    error?: string;
+}
+
+type Listener = (status: ConversionStatus) => void;
+
+// 파일별 최신 변환 상태와 구독자 목록
+const statuses = new Map<string, ConversionStatus>();
+const listeners = new Map<string, Set<Listener>>();
+
+export const WebSocketEvents = {
+    queued: `custom_${manifest.id}_conversion_queued`,
+    started: `custom_${manifest.id}_conversion_started`,
+    progress: `custom_${manifest.id}_conversion_progress`,
+    done: `custom_${manifest.id}_conversion_done`,
+    failed: `custom_${manifest.id}_conversion_failed`,
+};
+
+export function getConversionStatus(fileId: string): ConversionStatus | undefined {
+    return statuses.get(fileId);
+}
+
+export function setConversionStatus(status: ConversionStatus) {
+    statuses.set(status.file_id, status);
+    listeners.get(status.file_id)?.forEach((listener) => listener(status));
+}
+
+export function subscribeConversionStatus(fileId: string, listener: Listener): () => void {
+    if (!listeners.has(fileId)) {
+        listeners.set(fileId, new Set());
+    }
+    listeners.get(fileId)!.add(listener);
+    return () => {
+        listeners.get(fileId)?.delete(listener);
+    };
+}
+
+export async function fetchConversionStatus(fileId: string): Promise<ConversionStatus | undefined> {
+    const basename = (window as any).basename || '';
+    const response = await fetch(`${basename}/plugins/${manifest.id}/api/v1/conversions/${fileId}`, {
+        credentials: 'include',
+        headers: {'X-Requested-With': 'XMLHttpRequest'},
+    });
+    if (!response.ok) {
+        return undefined;
+    }
+    const status: ConversionStatus = await response.json();
+    setConversionStatus(status);
+    return status;
+}
+
+// 서버가 보내는 WebSocket 이벤트를 상태로 변환
+export function handleConversionEvent(msg: {event: string; data: any}) {
+    const current = statuses.get(msg.data.file_id);
+    let state: ConversionState;
+    switch (msg.event) {
+    case WebSocketEvents.queued:
+        state = 'queued';
+        break;
+    case WebSocketEvents.started:
+    case WebSocketEvents.progress:
+        state = 'running';
+        break;
+    case WebSocketEvents.done:
+        state = 'succeeded';
+        break;
+    case WebSocketEvents.failed:
+        state = 'failed';
+        break;
+    default:
+        return;
+    }
+
+    setConversionStatus({
+        ...current,
+        file_id: msg.data.file_id,
+        post_id: msg.data.post_id,
+        state,
+        stage: msg.data.stage,
+        error: msg.data.error,
+    });
+}
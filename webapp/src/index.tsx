@@ -6,6 +6,7 @@ import type {Store, Action} from 'redux';
 import type {GlobalState} from '@mattermost/types/store';
 
 import MyFileAttachmentOverride from './components/FileAttachment';
+import {WebSocketEvents, handleConversionEvent} from './conversion_status';
 
 import manifest from '@/manifest';
 import type {PluginRegistry} from '@/types/mattermost-webapp';
@@ -19,6 +20,11 @@ export default class Plugin {
 
         // 등록: override 조건과 커스텀 컴포넌트를 등록
         registry.registerFilePreviewComponent(override, MyFileAttachmentOverride);
+
+        // 변환 상태 이벤트 구독
+        Object.values(WebSocketEvents).forEach((event) => {
+            registry.registerWebSocketEventHandler(event, handleConversionEvent);
+        });
     }
 }
 
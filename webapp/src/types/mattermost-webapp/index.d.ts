@@ -15,5 +15,12 @@ export interface PluginRegistry {
         component: React.ElementType
     ): string;
 
+    /**
+     * Register a handler for WebSocket events, including custom events published by the plugin server.
+     * @param event The event name, e.g. custom_<plugin id>_<event>.
+     * @param handler A function receiving the WebSocket message.
+     */
+    registerWebSocketEventHandler(event: string, handler: (msg: {event: string; data: any}) => void): void;
+
     // Add more if needed from https://developers.mattermost.com/extend/plugins/webapp/reference
 }
@@ -0,0 +1,70 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import manifest from '@/manifest';
+
+export interface ViewerToken {
+    viewer_url: string;
+    token: string;
+    expires_at: number;
+    user_id: string;
+    user_name: string;
+    file_id: string;
+    post_id: string;
+    file_path: string;
+    authority: number;
+}
+
+function getCSRFToken(): string {
+    const match = document.cookie.match(/(?:^|;\s*)MMCSRF=([^;]+)/);
+    return match ? decodeURIComponent(match[1]) : '';
+}
+
+// 서버에서 서명된 뷰어 토큰 발급
+export async function requestViewerToken(fileId: string): Promise<ViewerToken> {
+    const basename = (window as any).basename || '';
+    const response = await fetch(`${basename}/plugins/${manifest.id}/api/v1/viewer/token?fileID=${encodeURIComponent(fileId)}`, {
+        method: 'POST',
+        credentials: 'include',
+        headers: {
+            'X-Requested-With': 'XMLHttpRequest',
+            'X-CSRF-Token': getCSRFToken(),
+        },
+    });
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    return response.json();
+}
+
+// 뷰어 토큰으로 Collabview 뷰어 열기
+export function openViewer(viewerToken: ViewerToken) {
+    const params: Record<string, string> = {
+        authority: String(viewerToken.authority),
+        userName: viewerToken.user_name,
+        userID: viewerToken.user_id,
+        objectID: viewerToken.file_id,
+        filePath: viewerToken.file_path,
+        token: viewerToken.token,
+    };
+
+    // 동적으로 form 요소 생성
+    const form = document.createElement('form');
+    form.method = 'POST';
+    form.action = viewerToken.viewer_url;
+
+    // 숨겨진 input 필드 생성 후 추가
+    for (const key in params) {
+        if (Object.prototype.hasOwnProperty.call(params, key)) {
+            const input = document.createElement('input');
+            input.type = 'hidden';
+            input.name = key;
+            input.value = params[key];
+            form.appendChild(input);
+        }
+    }
+
+    // 문서에 form 추가 후 제출
+    document.body.appendChild(form);
+    form.submit();
+}